@@ -2,9 +2,11 @@ package db
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/list-notifications-rw/mapping"
 	"github.com/Financial-Times/list-notifications-rw/model"
 	"github.com/Financial-Times/upp-go-sdk/pkg/mongodb"
 	"go.mongodb.org/mongo-driver/bson"
@@ -13,16 +15,20 @@ import (
 )
 
 type Client struct {
-	database   string
-	collection string
-	maxLimit   int
-	cacheDelay int
-	client     *mongo.Client
-	log        *logger.UPPLogger
+	database                string
+	collection              string
+	outboxCollection        string
+	subscriptionsCollection string
+	maxLimit                int
+	cacheDelay              int
+	client                  *mongo.Client
+	log                     *logger.UPPLogger
 }
 
-// NewClient creates new client instance
-func NewClient(address, username, password, database, collection string, cacheDelay, maxLimit int, log *logger.UPPLogger) (*Client, error) {
+// NewClient creates new client instance. If outboxCollection is not empty, every notification is also written to the
+// outbox collection in the same transaction, ready to be published downstream. Webhook subscriptions are stored in the
+// subscriptionsCollection.
+func NewClient(address, username, password, database, collection, outboxCollection, subscriptionsCollection string, cacheDelay, maxLimit int, log *logger.UPPLogger) (*Client, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 	defer cancel()
 
@@ -37,34 +43,118 @@ func NewClient(address, username, password, database, collection string, cacheDe
 	}
 
 	return &Client{
-		client:     client,
-		database:   database,
-		collection: collection,
-		cacheDelay: cacheDelay,
-		maxLimit:   maxLimit,
-		log:        log,
+		client:                  client,
+		database:                database,
+		collection:              collection,
+		outboxCollection:        outboxCollection,
+		subscriptionsCollection: subscriptionsCollection,
+		cacheDelay:              cacheDelay,
+		maxLimit:                maxLimit,
+		log:                     log,
 	}, nil
 }
 
-// WriteNotification inserts a notification into database
+// WriteNotification inserts a notification into database. Notifications are unique on uuid and publishReference,
+// so writing the same notification twice results in a duplicate key error (see mongo.IsDuplicateKeyError).
 func (c *Client) WriteNotification(notification *model.InternalNotification) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 
+	if c.OutboxEnabled() {
+		return c.writeNotificationWithOutbox(ctx, notification)
+	}
+
 	collection := c.client.Database(c.database).Collection(c.collection)
 	_, err := collection.InsertOne(ctx, notification)
 	return err
 }
 
-// ReadNotifications reads notifications from the collection.
-func (c *Client) ReadNotifications(offset int, since time.Time) (*[]model.InternalNotification, error) {
+// WriteNotifications inserts many notifications into database. The insert is unordered, so a failure for one notification
+// does not prevent the others from being written; any per-notification failures are returned as a mongo.BulkWriteException.
+func (c *Client) WriteNotifications(notifications []*model.InternalNotification) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	if c.OutboxEnabled() {
+		return c.writeNotificationsWithOutbox(ctx, notifications)
+	}
+
+	docs := make([]interface{}, 0, len(notifications))
+	for _, n := range notifications {
+		docs = append(docs, n)
+	}
+
+	collection := c.client.Database(c.database).Collection(c.collection)
+	_, err := collection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	return err
+}
+
+// ReadNotifications reads a page of notifications which match the filter from the collection. A limit of zero, or above
+// the max limit, reads a page of the max limit.
+func (c *Client) ReadNotifications(offset int, limit int, since time.Time, filter model.NotificationFilter) (*[]model.InternalNotification, error) {
+	query := generateQuery(c.cacheDelay, offset, mapping.PageLimit(limit, c.maxLimit), since, filter, c.log)
+	return c.aggregate(query)
+}
+
+// ReadNotificationsAfter reads the notifications which match the filter, and follow the notification with the given lastModified date, uuid and publishReference.
+func (c *Client) ReadNotificationsAfter(lastModified time.Time, uuid string, publishReference string, limit int, filter model.NotificationFilter) (*[]model.InternalNotification, error) {
+	query := generateCursorQuery(c.cacheDelay, mapping.PageLimit(limit, c.maxLimit), lastModified, uuid, publishReference, filter, c.log)
+	return c.aggregate(query)
+}
+
+// ReadHistory reads a page of every notification for the list, oldest first, without collapsing them into one.
+func (c *Client) ReadHistory(uuid string, offset int, limit int, since time.Time, until time.Time) (*[]model.InternalNotification, error) {
+	query := generateHistoryQuery(c.cacheDelay, offset, mapping.PageLimit(limit, c.maxLimit), uuid, since, until, c.log)
+	return c.aggregate(query, options.Aggregate().SetHint(uuidIndexName))
+}
+
+// ReadHistoryAfter reads a page of every notification for the list which follows the notification with the given lastModified date and publishReference.
+func (c *Client) ReadHistoryAfter(uuid string, lastModified time.Time, publishReference string, limit int, until time.Time) (*[]model.InternalNotification, error) {
+	query := generateHistoryCursorQuery(c.cacheDelay, mapping.PageLimit(limit, c.maxLimit), uuid, lastModified, publishReference, until, c.log)
+	return c.aggregate(query, options.Aggregate().SetHint(uuidIndexName))
+}
+
+// CountNotificationsBetween counts the stored notifications which match the filter, and which a reader from the since
+// date would read before reaching the until date. Notifications are counted without collapsing them.
+func (c *Client) CountNotificationsBetween(since time.Time, until time.Time, filter model.NotificationFilter) (int64, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 	defer cancel()
 
-	query := generateQuery(c.cacheDelay, offset, c.maxLimit, since, c.log)
+	collection := c.client.Database(c.database).Collection(c.collection)
+	return collection.CountDocuments(ctx, findBetween(c.cacheDelay, since, until, filter))
+}
+
+// ExportNotifications reads every notification which matches the filter and was last modified from the since date
+// onwards, calling export with each in turn. The notifications are read with a cursor, so they are not all held in
+// memory, and the export is only limited by the context.
+func (c *Client) ExportNotifications(ctx context.Context, since time.Time, filter model.NotificationFilter, export func(notification model.InternalNotification) error) error {
+	query := generateExportQuery(c.cacheDelay, since, filter, c.log)
+
+	collection := c.client.Database(c.database).Collection(c.collection)
+	cursor, err := collection.Aggregate(ctx, query, options.Aggregate().SetAllowDiskUse(true).SetBatchSize(int32(c.maxLimit)))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(context.Background())
+
+	for cursor.Next(ctx) {
+		var notification model.InternalNotification
+		if err = cursor.Decode(&notification); err != nil {
+			return err
+		}
+		if err = export(notification); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func (c *Client) aggregate(query []bson.M, opts ...*options.AggregateOptions) (*[]model.InternalNotification, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
 
 	collection := c.client.Database(c.database).Collection(c.collection)
-	pipe, err := collection.Aggregate(ctx, query)
+	pipe, err := collection.Aggregate(ctx, query, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -89,7 +179,47 @@ func (c *Client) FindNotificationByPartialTransactionID(transactionID string) (m
 	return c.findNotificationWithFilter(filter)
 }
 
-func (c *Client) findNotificationWithFilter(filter bson.M) (model.InternalNotification, error) {
+// FindNotificationsByTransactionID finds the notifications with the given Transaction ID (publishReference), oldest first,
+// or if prefix is true, whose Transaction IDs start with it, in Transaction ID order. Prefix matches are sorted on the
+// publishReference index, so that the limit is applied without sorting every match. Up to the max limit of
+// notifications are returned.
+func (c *Client) FindNotificationsByTransactionID(transactionID string, prefix bool) ([]model.InternalNotification, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	filter := findByTransactionID(transactionID)
+	sort := bson.D{{Key: "lastModified", Value: 1}}
+	if prefix {
+		filter = findByPartialTransactionID(transactionID)
+		sort = bson.D{{Key: "publishReference", Value: 1}}
+	}
+
+	collection := c.client.Database(c.database).Collection(c.collection)
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(sort).SetLimit(int64(c.maxLimit)))
+	if err != nil {
+		return nil, err
+	}
+
+	var notifications []model.InternalNotification
+	if err = cursor.All(ctx, &notifications); err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+// FindLatestNotification locates the most recent notification for the list with the given uuid, ignoring superseded notifications
+func (c *Client) FindLatestNotification(uuid string) (model.InternalNotification, error) {
+	filter := findLatestCandidates(uuid)
+	return c.findNotificationWithFilter(filter, options.FindOne().SetSort(bson.M{"lastModified": -1}))
+}
+
+// FindRecordedNotification locates the notification for the list with the given uuid and Transaction ID (publishReference)
+func (c *Client) FindRecordedNotification(uuid string, publishReference string) (model.InternalNotification, error) {
+	filter := findRecorded(uuid, publishReference)
+	return c.findNotificationWithFilter(filter)
+}
+
+func (c *Client) findNotificationWithFilter(filter bson.M, opts ...*options.FindOneOptions) (model.InternalNotification, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 	defer cancel()
 
@@ -98,11 +228,14 @@ func (c *Client) findNotificationWithFilter(filter bson.M) (model.InternalNotifi
 		client.
 		Database(c.database).
 		Collection(c.collection).
-		FindOne(ctx, filter).
+		FindOne(ctx, filter, opts...).
 		Decode(&notification)
 	return notification, err
 }
 
+// uuidIndexName is the name of the index on list uuids, which history reads use to find every notification for a list
+const uuidIndexName = "uuid-index"
+
 // EnsureIndexes creates indexes
 func (c *Client) EnsureIndexes() error {
 	lastModifiedName := "last-modified-index"
@@ -119,23 +252,128 @@ func (c *Client) EnsureIndexes() error {
 			Name: &publishReferenceName,
 		},
 	}
-	uuidName := "uuid-index"
+	uuidName := uuidIndexName
 	uuidIndex := mongo.IndexModel{
 		Keys: bson.M{"uuid": 1},
 		Options: &options.IndexOptions{
 			Name: &uuidName,
 		},
 	}
+	lastModifiedUUIDName := "last-modified-uuid-index"
+	lastModifiedUUIDIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "lastModified", Value: 1}, {Key: "uuid", Value: 1}},
+		Options: &options.IndexOptions{
+			Name: &lastModifiedUUIDName,
+		},
+	}
 
 	collection := c.client.Database(c.database).Collection(c.collection)
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 
-	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{lastModifiedIndex, publishReferenceIndex, uuidIndex})
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{lastModifiedIndex, publishReferenceIndex, uuidIndex, lastModifiedUUIDIndex})
+	if err != nil || !c.OutboxEnabled() {
+		return err
+	}
+
+	return c.ensureOutboxIndexes(ctx)
+}
+
+// uniqueIndexName is the name of the unique index on uuid and publishReference
+const uniqueIndexName = "uuid-publish-reference-index"
+
+// EnsureUniqueIndex creates the unique index on uuid and publishReference, which makes writing a notification idempotent.
+// It is created separately from the other indexes, as it cannot be built while duplicate notifications are stored (see
+// RemoveDuplicateNotifications), and a failure to build it would otherwise fail the other indexes too. Building it may
+// take a long time on a large collection, so it should not be waited for before serving.
+func (c *Client) EnsureUniqueIndex() error {
+	name := uniqueIndexName
+	unique := true
+	uuidPublishReferenceIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "uuid", Value: 1}, {Key: "publishReference", Value: 1}},
+		Options: &options.IndexOptions{
+			Name:   &name,
+			Unique: &unique,
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	collection := c.client.Database(c.database).Collection(c.collection)
+	_, err := collection.Indexes().CreateOne(ctx, uuidPublishReferenceIndex)
 	return err
 }
 
+// HasUniqueIndex returns an error if the unique index on uuid and publishReference has not been built
+func (c *Client) HasUniqueIndex() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	collection := c.client.Database(c.database).Collection(c.collection)
+	specs, err := collection.Indexes().ListSpecifications(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, spec := range specs {
+		if spec.Name == uniqueIndexName {
+			return nil
+		}
+	}
+	return fmt.Errorf("the %s index has not been built", uniqueIndexName)
+}
+
+// RemoveDuplicateNotifications deletes every notification which has the same uuid and publishReference as one written
+// before it, as retried writes stored before the unique index existed. It returns the number of notifications deleted.
+func (c *Client) RemoveDuplicateNotifications() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*30)
+	defer cancel()
+
+	collection := c.client.Database(c.database).Collection(c.collection)
+	cursor, err := collection.Aggregate(ctx, findDuplicates(), options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(context.Background())
+
+	removed := int64(0)
+	for cursor.Next(ctx) {
+		var duplicates struct {
+			IDs []interface{} `bson:"ids"`
+		}
+		if err = cursor.Decode(&duplicates); err != nil {
+			return removed, err
+		}
+
+		result, err := collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": duplicates.IDs[1:]}}) // keep the first written
+		if err != nil {
+			return removed, err
+		}
+		removed += result.DeletedCount
+	}
+	return removed, cursor.Err()
+}
+
+// acquireLease takes or renews the lease with the given id, so only one instance does the leased work at a time.
+// It returns false if another owner holds an unexpired lease.
+func (c *Client) acquireLease(collection string, id string, owner string, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	now := time.Now().UTC()
+	leases := c.client.Database(c.database).Collection(collection)
+	_, err := leases.UpdateOne(ctx, findAvailableLease(id, owner, now), bson.M{
+		"$set": bson.M{"owner": owner, "expiresAt": now.Add(ttl)},
+	}, options.Update().SetUpsert(true))
+
+	if mongo.IsDuplicateKeyError(err) { // the lease exists, but is held by someone else
+		return false, nil
+	}
+	return err == nil, err
+}
+
 // GetLimit returns the max number of records returned by a query
 func (c *Client) GetLimit() int {
 	return c.maxLimit
@@ -91,7 +91,7 @@ func TestReadWriteFind(t *testing.T) {
 	}
 	require.NoError(t, client.WriteNotification(&notification))
 
-	notifications, err := client.ReadNotifications(0, exampleTime)
+	notifications, err := client.ReadNotifications(0, 0, exampleTime, model.NotificationFilter{})
 	require.NoError(t, err, "Should not error")
 	assert.NotNil(t, notifications, "Should not be nil")
 
@@ -0,0 +1,184 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Financial-Times/list-notifications-rw/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const outboxLeaseID = "outbox-dispatcher"
+
+// published outbox messages are kept for a week for debugging, then expire
+const outboxRetention = 7 * 24 * time.Hour
+
+// OutboxEnabled returns true if notifications are also written to the outbox
+func (c *Client) OutboxEnabled() bool {
+	return c.outboxCollection != ""
+}
+
+// writeNotificationWithOutbox inserts the notification and its outbox message in a single transaction
+func (c *Client) writeNotificationWithOutbox(ctx context.Context, notification *model.InternalNotification) error {
+	session, err := c.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	collection := c.client.Database(c.database).Collection(c.collection)
+	outbox := c.client.Database(c.database).Collection(c.outboxCollection)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		if _, err := collection.InsertOne(sc, notification); err != nil {
+			return nil, err
+		}
+		return outbox.InsertOne(sc, newOutboxMessage(notification))
+	})
+	return err
+}
+
+// writeNotificationsWithOutbox writes each notification with its outbox message in its own transaction, so one failure
+// does not prevent the others from being written. Per-notification failures are returned as a mongo.BulkWriteException.
+func (c *Client) writeNotificationsWithOutbox(ctx context.Context, notifications []*model.InternalNotification) error {
+	var writeErrors []mongo.BulkWriteError
+	for i, notification := range notifications {
+		err := c.writeNotificationWithOutbox(ctx, notification)
+		if err == nil {
+			continue
+		}
+
+		var writeErr mongo.WriteException
+		if !errors.As(err, &writeErr) || len(writeErr.WriteErrors) == 0 {
+			return err
+		}
+
+		writeErrors = append(writeErrors, mongo.BulkWriteError{
+			WriteError: mongo.WriteError{
+				Index:   i,
+				Code:    writeErr.WriteErrors[0].Code,
+				Message: writeErr.WriteErrors[0].Message,
+			},
+		})
+	}
+
+	if len(writeErrors) > 0 {
+		return mongo.BulkWriteException{WriteErrors: writeErrors}
+	}
+	return nil
+}
+
+func newOutboxMessage(notification *model.InternalNotification) model.OutboxMessage {
+	return model.OutboxMessage{
+		ID:           notification.UUID + "/" + notification.PublishReference,
+		Notification: *notification,
+		CreatedAt:    time.Now().UTC(),
+	}
+}
+
+// ReadOutbox reads the oldest unpublished outbox messages for the lists which have no message waiting to be retried.
+// The messages for those lists must wait in order behind the retried message, so are skipped rather than being allowed
+// to fill the batch and hold up every other list.
+func (c *Client) ReadOutbox(limit int, now time.Time) ([]model.OutboxMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	outbox := c.client.Database(c.database).Collection(c.outboxCollection)
+	retrying, err := outbox.Distinct(ctx, "notification.uuid", findRetrying(now))
+	if err != nil {
+		return nil, err
+	}
+
+	blocked := make([]string, 0, len(retrying))
+	for _, uuid := range retrying {
+		if uuid, ok := uuid.(string); ok {
+			blocked = append(blocked, uuid)
+		}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}).SetLimit(int64(limit))
+	cursor, err := outbox.Find(ctx, findUnpublishedExcept(blocked), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []model.OutboxMessage
+	if err = cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// MarkOutboxPublished records that the outbox message has been published
+func (c *Client) MarkOutboxPublished(id string) error {
+	return c.updateOutbox(id, bson.M{"$set": bson.M{"publishedAt": time.Now().UTC()}})
+}
+
+// MarkOutboxFailed records a failed attempt to publish the outbox message, and when it should next be attempted
+func (c *Client) MarkOutboxFailed(id string, attempts int, nextAttemptAt time.Time, reason string) error {
+	return c.updateOutbox(id, bson.M{"$set": bson.M{
+		"attempts":      attempts,
+		"nextAttemptAt": nextAttemptAt,
+		"lastError":     reason,
+	}})
+}
+
+func (c *Client) updateOutbox(id string, update bson.M) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	outbox := c.client.Database(c.database).Collection(c.outboxCollection)
+	_, err := outbox.UpdateByID(ctx, id, update)
+	return err
+}
+
+// OutboxBacklogAge returns the age of the oldest unpublished outbox message, or zero if there are none
+func (c *Client) OutboxBacklogAge() (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	opts := options.FindOne().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+
+	var oldest model.OutboxMessage
+	outbox := c.client.Database(c.database).Collection(c.outboxCollection)
+	err := outbox.FindOne(ctx, findUnpublished(), opts).Decode(&oldest)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return time.Since(oldest.CreatedAt), nil
+}
+
+// AcquireOutboxLease takes or renews the lease for publishing the outbox, so only one instance publishes at a time.
+// It returns false if another owner holds an unexpired lease.
+func (c *Client) AcquireOutboxLease(owner string, ttl time.Duration) (bool, error) {
+	return c.acquireLease(c.outboxCollection+"-lease", outboxLeaseID, owner, ttl)
+}
+
+func (c *Client) ensureOutboxIndexes(ctx context.Context) error {
+	createdAtName := "unpublished-created-at-index"
+	createdAtIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "publishedAt", Value: 1}, {Key: "createdAt", Value: 1}},
+		Options: &options.IndexOptions{
+			Name: &createdAtName,
+		},
+	}
+	retentionName := "published-at-ttl-index"
+	retention := int32(outboxRetention.Seconds())
+	retentionIndex := mongo.IndexModel{
+		Keys: bson.M{"publishedAt": 1},
+		Options: &options.IndexOptions{
+			Name:               &retentionName,
+			ExpireAfterSeconds: &retention,
+		},
+	}
+
+	outbox := c.client.Database(c.database).Collection(c.outboxCollection)
+	_, err := outbox.Indexes().CreateMany(ctx, []mongo.IndexModel{createdAtIndex, retentionIndex})
+	return err
+}
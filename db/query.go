@@ -2,9 +2,11 @@ package db
 
 import (
 	"encoding/json"
+	"regexp"
 	"time"
 
 	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/list-notifications-rw/model"
 	"go.mongodb.org/mongo-driver/bson"
 )
 
@@ -12,87 +14,390 @@ func findByTransactionID(transactionID string) bson.M {
 	return bson.M{"publishReference": transactionID}
 }
 
+// findByPartialTransactionID matches the publishReferences which start with the transaction id; any regex
+// metacharacters in the transaction id are matched literally
 func findByPartialTransactionID(transactionID string) bson.M {
-	return bson.M{"publishReference": bson.M{"$regex": "^" + transactionID}}
+	return bson.M{"publishReference": bson.M{"$regex": "^" + regexp.QuoteMeta(transactionID)}}
 }
 
-func generateQuery(delay, offset, maxLimit int, since time.Time, log *logger.UPPLogger) []bson.M {
-	match := getMatch(delay, offset, since)
+// findLatestCandidates matches the notifications for the list which may be its latest, i.e. those not superseded
+func findLatestCandidates(uuid string) bson.M {
+	return bson.M{"uuid": uuid, "superseded": bson.M{"$ne": true}}
+}
+
+// findRecorded matches the notification with the uuid and publishReference, which are unique together
+func findRecorded(uuid string, publishReference string) bson.M {
+	return bson.M{"uuid": uuid, "publishReference": publishReference}
+}
+
+// notSuperseded leaves out the notifications which were written after a newer notification for the same list (e.g. by a
+// backfill), which must not be collapsed into the latest notification for the list
+func notSuperseded() bson.M {
+	return bson.M{"$match": bson.M{"superseded": bson.M{"$ne": true}}}
+}
+
+// findBetween matches the notifications which a reader from the since date would read before reaching the until date
+func findBetween(delay int, since time.Time, until time.Time, filter model.NotificationFilter) bson.M {
+	return withFilter(bson.M{
+		"lastModified": bson.M{
+			"$gt":  shiftSince(delay, since),
+			"$lte": shiftSince(delay, until),
+		},
+	}, filter)
+}
+
+// findDuplicates groups the ids of the notifications which share a uuid and publishReference, oldest first, for every
+// group of more than one
+func findDuplicates() []bson.M {
+	return []bson.M{
+		{"$sort": bson.M{"_id": 1}},
+		{
+			"$group": bson.M{
+				"_id":   bson.M{"uuid": "$uuid", "publishReference": "$publishReference"},
+				"ids":   bson.M{"$push": "$_id"},
+				"count": bson.M{"$sum": 1},
+			},
+		},
+		{"$match": bson.M{"count": bson.M{"$gt": 1}}},
+	}
+}
+
+func findUnpublished() bson.M {
+	return bson.M{"publishedAt": bson.M{"$exists": false}}
+}
+
+// findRetrying matches the unpublished outbox messages which are waiting until after now to be retried
+func findRetrying(now time.Time) bson.M {
+	return bson.M{"publishedAt": bson.M{"$exists": false}, "nextAttemptAt": bson.M{"$gt": now}}
+}
+
+// findUnpublishedExcept matches the unpublished outbox messages, except for those for the given lists
+func findUnpublishedExcept(uuids []string) bson.M {
+	query := findUnpublished()
+	if len(uuids) > 0 {
+		query["notification.uuid"] = bson.M{"$nin": uuids}
+	}
+	return query
+}
+
+func findAvailableLease(id string, owner string, now time.Time) bson.M {
+	return bson.M{
+		"_id": id,
+		"$or": []bson.M{
+			{"owner": owner},
+			{"expiresAt": bson.M{"$lt": now}},
+		},
+	}
+}
+
+func generateQuery(delay, offset, maxLimit int, since time.Time, filter model.NotificationFilter, log *logger.UPPLogger) []bson.M {
+	match := getMatch(delay, offset, since, filter)
+
+	var pipeline []bson.M
+	if filter.Uncollapsed {
+		pipeline = []bson.M{
+			match,             // get all records that exist between the start and end dates
+			uncollapsedSort(), // sort by oldest first, then by uuid and publishReference so every record has a strict order
+		}
+	} else {
+		pipeline = []bson.M{
+			match,           // get all records that exist between the start and end dates
+			notSuperseded(), // leave out notifications older than the list's latest notification when written
+			{
+				"$sort": bson.M{
+					"lastModified": -1,
+				},
+			}, // sort most recent notifications first
+			collapse(), // create one notification per list
+			{
+				"$sort": bson.M{
+					"lastModified": 1,
+					"uuid":         1,
+				},
+			}, // sort by oldest first, and to ensure strict ordering, also sort by uuid when lastModified dates match
+		}
+	}
+
+	pipeline = append(pipeline,
+		bson.M{"$skip": offset},
+		bson.M{"$limit": maxLimit + 1},
+	)
+
+	logQuery(pipeline, log)
+	return pipeline
+}
+
+// generateCursorQuery seeks to the notifications which follow the given lastModified date and uuid, rather than skipping an offset.
+// Uncollapsed notifications for the same list are also ordered by publishReference, so they follow the given publishReference.
+func generateCursorQuery(delay, maxLimit int, lastModified time.Time, uuid string, publishReference string, filter model.NotificationFilter, log *logger.UPPLogger) []bson.M {
+	till := calculateTill(delay, time.Now().UTC())
+
+	match := bson.M{
+		"$match": withFilter(bson.M{
+			"lastModified": withUntil(bson.M{
+				"$gte": lastModified,
+				"$lt":  till,
+			}, till, shiftUntil(delay, filter.Until)),
+		}, filter),
+	} // get all records that exist between the cursor and end dates
+
+	if filter.Uncollapsed {
+		pipeline := []bson.M{
+			match,
+			{
+				"$match": bson.M{
+					"$or": []bson.M{
+						{"lastModified": bson.M{"$gt": lastModified}},
+						{"lastModified": lastModified, "uuid": bson.M{"$gt": uuid}},
+						{"lastModified": lastModified, "uuid": uuid, "publishReference": bson.M{"$gt": publishReference}},
+					},
+				},
+			}, // skip the notifications up to and including the cursor
+			uncollapsedSort(), // sort in the same order as the cursor
+			{"$limit": maxLimit + 1},
+		}
+
+		logQuery(pipeline, log)
+		return pipeline
+	}
 
 	pipeline := []bson.M{
-		match, // get all records that exist between the start and end dates
+		match,
+		notSuperseded(),
 		{
 			"$sort": bson.M{
 				"lastModified": -1,
 			},
 		}, // sort most recent notifications first
+		collapse(), // create one notification per list
 		{
-			"$group": bson.M{
-				"_id": "$uuid", // group all notifications together by uuid...
-				"uuid": bson.M{
-					"$first": "$uuid",
-				},
-				"title": bson.M{
-					"$first": "$title",
+			"$match": bson.M{
+				"$or": []bson.M{
+					{"lastModified": bson.M{"$gt": lastModified}},
+					{"lastModified": lastModified, "uuid": bson.M{"$gt": uuid}},
 				},
-				"eventType": bson.M{
-					"$first": "$eventType",
+			},
+		}, // skip the notifications up to and including the cursor
+		{
+			"$sort": bson.D{
+				{Key: "lastModified", Value: 1},
+				{Key: "uuid", Value: 1},
+			},
+		}, // sort in the same order as the cursor, i.e. oldest first, then by uuid
+		{"$limit": maxLimit + 1},
+	}
+
+	logQuery(pipeline, log)
+	return pipeline
+}
+
+// generateExportQuery reads every notification last modified between the since and until dates, collapsed unless the
+// filter asks otherwise, oldest first. Unlike the other queries, it is not paginated.
+func generateExportQuery(delay int, since time.Time, filter model.NotificationFilter, log *logger.UPPLogger) []bson.M {
+	till := calculateTill(delay, time.Now().UTC())
+
+	match := bson.M{
+		"$match": withFilter(bson.M{
+			"lastModified": withUntil(bson.M{
+				"$gte": since,
+				"$lt":  till,
+			}, till, filter.Until),
+		}, filter),
+	} // get all records that exist between the start and end dates
+
+	pipeline := []bson.M{match, uncollapsedSort()}
+	if !filter.Uncollapsed {
+		pipeline = []bson.M{
+			match,
+			notSuperseded(),
+			{
+				"$sort": bson.M{
+					"lastModified": -1,
 				},
-				"publishReference": bson.M{
-					"$first": "$publishReference",
+			}, // sort most recent notifications first
+			collapse(), // create one notification per list
+			{
+				"$sort": bson.D{
+					{Key: "lastModified", Value: 1},
+					{Key: "uuid", Value: 1},
 				},
-				"lastModified": bson.M{
-					"$first": "$lastModified",
+			}, // sort by oldest first, then by uuid
+		}
+	}
+
+	logQuery(pipeline, log)
+	return pipeline
+}
+
+// uncollapsedSort orders every notification by lastModified, then uuid, then publishReference, which is unique for each list
+func uncollapsedSort() bson.M {
+	return bson.M{
+		"$sort": bson.D{
+			{Key: "lastModified", Value: 1},
+			{Key: "uuid", Value: 1},
+			{Key: "publishReference", Value: 1},
+		},
+	}
+}
+
+// generateHistoryQuery reads every notification for a single list, without collapsing them, oldest first. Notifications
+// which were last modified at the same time are ordered by publishReference, which is unique for each list.
+func generateHistoryQuery(delay, offset, maxLimit int, uuid string, since time.Time, until time.Time, log *logger.UPPLogger) []bson.M {
+	pipeline := []bson.M{
+		getMatch(delay, offset, since, model.NotificationFilter{UUIDs: []string{uuid}, Until: until}),
+		{
+			"$sort": bson.D{
+				{Key: "lastModified", Value: 1},
+				{Key: "publishReference", Value: 1},
+			},
+		}, // sort by oldest first
+		{"$skip": offset},
+		{"$limit": maxLimit + 1},
+	}
+
+	logQuery(pipeline, log)
+	return pipeline
+}
+
+// generateHistoryCursorQuery reads every notification for a single list which follows the given lastModified date and publishReference.
+func generateHistoryCursorQuery(delay, maxLimit int, uuid string, lastModified time.Time, publishReference string, until time.Time, log *logger.UPPLogger) []bson.M {
+	till := calculateTill(delay, time.Now().UTC())
+
+	pipeline := []bson.M{
+		{
+			"$match": bson.M{
+				"uuid": uuid,
+				"lastModified": withUntil(bson.M{
+					"$gte": lastModified,
+					"$lt":  till,
+				}, till, shiftUntil(delay, until)),
+				"$or": []bson.M{
+					{"lastModified": bson.M{"$gt": lastModified}},
+					{"lastModified": lastModified, "publishReference": bson.M{"$gt": publishReference}},
 				},
 			},
-		}, //... and create one notification based on the most recent fields (the "first" notification's fields)
+		}, // get the records for the list after the cursor
 		{
-			"$sort": bson.M{
-				"lastModified": 1,
-				"uuid":         1,
+			"$sort": bson.D{
+				{Key: "lastModified", Value: 1},
+				{Key: "publishReference", Value: 1},
 			},
-		}, // sort by oldest first, and to ensure strict ordering, also sort by uuid when lastModified dates match
-		{"$skip": offset},
+		}, // sort in the same order as the cursor
 		{"$limit": maxLimit + 1},
 	}
 
+	logQuery(pipeline, log)
+	return pipeline
+}
+
+// collapse groups all notifications together by uuid, and creates one notification based on the most recent fields (the "first" notification's fields).
+// The items are left out, as only the item changes are read, and the full item arrays would be carried through the group.
+func collapse() bson.M {
+	return bson.M{
+		"$group": bson.M{
+			"_id": "$uuid",
+			"uuid": bson.M{
+				"$first": "$uuid",
+			},
+			"title": bson.M{
+				"$first": "$title",
+			},
+			"eventType": bson.M{
+				"$first": "$eventType",
+			},
+			"publishReference": bson.M{
+				"$first": "$publishReference",
+			},
+			"lastModified": bson.M{
+				"$first": "$lastModified",
+			},
+			"layoutHint": bson.M{
+				"$first": "$layoutHint",
+			},
+			"listType": bson.M{
+				"$first": "$listType",
+			},
+			"concept": bson.M{
+				"$first": "$concept",
+			},
+			"addedItems": bson.M{
+				"$first": "$addedItems",
+			},
+			"removedItems": bson.M{
+				"$first": "$removedItems",
+			},
+			"reordered": bson.M{
+				"$first": "$reordered",
+			},
+		},
+	}
+}
+
+func logQuery(pipeline []bson.M, log *logger.UPPLogger) {
 	j, err := json.Marshal(pipeline)
 	if err == nil { // Use /__log/debug endpoint to see the full query.
 		log.WithField("query", string(j)).Debug("Full query.")
 	}
-
-	return pipeline
 }
 
-func getMatch(delay, offset int, since time.Time) bson.M {
+func getMatch(delay, offset int, since time.Time, filter model.NotificationFilter) bson.M {
 	shifted := shiftSince(delay, since)
 	till := calculateTill(delay, time.Now().UTC())
 
+	lastModified := bson.M{
+		"$gt": shifted,
+		"$lt": till,
+	}
 	if offset > 0 {
-		return bson.M{
-			"$match": bson.M{
-				"lastModified": bson.M{
-					"$gte": shifted,
-					"$lte": till,
-				},
-			},
+		lastModified = bson.M{
+			"$gte": shifted,
+			"$lte": till,
 		}
 	}
 
 	return bson.M{
-		"$match": bson.M{
-			"lastModified": bson.M{
-				"$gt": shifted,
-				"$lt": till,
-			},
-		},
+		"$match": withFilter(bson.M{
+			"lastModified": withUntil(lastModified, till, shiftUntil(delay, filter.Until)),
+		}, filter),
+	}
+}
+
+// withUntil replaces the upper bound of the lastModified range with the until date, if it is before the till date.
+// Except for exports, the until date must first be shifted like the since date (see shiftUntil).
+func withUntil(lastModified bson.M, till time.Time, until time.Time) bson.M {
+	if until.IsZero() || !until.Before(till) {
+		return lastModified
 	}
+
+	delete(lastModified, "$lte")
+	lastModified["$lt"] = until
+	return lastModified
+}
+
+// withFilter adds the given filter to the match
+func withFilter(match bson.M, filter model.NotificationFilter) bson.M {
+	if len(filter.UUIDs) > 0 {
+		match["uuid"] = bson.M{"$in": filter.UUIDs}
+	}
+	if len(filter.EventTypes) > 0 {
+		match["eventType"] = bson.M{"$in": filter.EventTypes}
+	}
+	return match
 }
 
 func shiftSince(cacheDelay int, since time.Time) time.Time {
 	return since.Add(time.Duration(-1*cacheDelay) * time.Second)
 }
 
+// shiftUntil shifts the until date back by the cache delay, as the since date is, so that a window ends where the next
+// window starting from its until date begins, and notifications are not read in both.
+func shiftUntil(cacheDelay int, until time.Time) time.Time {
+	if until.IsZero() {
+		return until
+	}
+	return shiftSince(cacheDelay, until)
+}
+
 func calculateTill(cacheDelay int, base time.Time) time.Time {
 	return base.Add(time.Duration(-1*cacheDelay) * time.Second)
 }
@@ -3,11 +3,16 @@ package db
 import (
 	"encoding/json"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/list-notifications-rw/mapping"
+	"github.com/Financial-Times/list-notifications-rw/model"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 func TestShiftSince(t *testing.T) {
@@ -27,7 +32,7 @@ func TestCalculateTillDate(t *testing.T) {
 func TestGetMatchNoOffset(t *testing.T) {
 	since := time.Now().UTC()
 
-	match := getMatch(10, 0, since)
+	match := getMatch(10, 0, since, model.NotificationFilter{})
 
 	data, err := json.Marshal(match)
 	assert.NoError(t, err)
@@ -39,7 +44,7 @@ func TestGetMatchWithOffset(t *testing.T) {
 	since, err := time.Parse(time.RFC3339Nano, "2016-10-26T16:15:09.46Z")
 	assert.NoError(t, err)
 
-	match := getMatch(10, 60, since)
+	match := getMatch(10, 60, since, model.NotificationFilter{})
 
 	data, err := json.Marshal(match)
 	assert.NoError(t, err)
@@ -47,14 +52,90 @@ func TestGetMatchWithOffset(t *testing.T) {
 	assert.True(t, regex.MatchString(string(data)), "Query json should match!")
 }
 
+func TestGetMatchWithUUIDs(t *testing.T) {
+	since := time.Now().UTC()
+
+	match := getMatch(10, 0, since, model.NotificationFilter{UUIDs: []string{"ef863741-709a-4062-a8f1-987c44db1db5", "2f0ea3a0-cd1d-4a3d-8a5a-02f1a7c1b1d9"}})
+
+	data, err := json.Marshal(match)
+	assert.NoError(t, err)
+	regex := regexp.MustCompile(`\{"\$match":\{"lastModified":\{"\$gt":".*","\$lt":".*"},"uuid":\{"\$in":\["ef863741-709a-4062-a8f1-987c44db1db5","2f0ea3a0-cd1d-4a3d-8a5a-02f1a7c1b1d9"]}}}`)
+	assert.True(t, regex.MatchString(string(data)), "Query json should match!")
+}
+
+func TestGetMatchWithEventTypes(t *testing.T) {
+	since := time.Now().UTC()
+
+	match := getMatch(10, 0, since, model.NotificationFilter{EventTypes: []string{"DELETE", "http://www.ft.com/thing/ThingChangeType/DELETE"}})
+
+	data, err := json.Marshal(match)
+	assert.NoError(t, err)
+	regex := regexp.MustCompile(`\{"\$match":\{"eventType":\{"\$in":\["DELETE","http://www.ft.com/thing/ThingChangeType/DELETE"]},"lastModified":\{"\$gt":".*","\$lt":".*"}}}`)
+	assert.True(t, regex.MatchString(string(data)), "Query json should match!")
+}
+
+func TestGetMatchWithUntil(t *testing.T) {
+	since := time.Date(2017, 02, 02, 9, 0, 0, 0, time.UTC)
+	until := time.Date(2017, 02, 02, 10, 0, 0, 0, time.UTC)
+
+	for _, offset := range []int{0, 60} {
+		match := getMatch(10, offset, since, model.NotificationFilter{Until: until})
+
+		data, err := json.Marshal(match)
+		assert.NoError(t, err)
+		regex := regexp.MustCompile(`\{"\$match":\{"lastModified":\{"\$gte?":"2017-02-02T08:59:50Z","\$lt":"2017-02-02T09:59:50Z"}}}`)
+		assert.True(t, regex.MatchString(string(data)), "Query json should match! %s", string(data))
+	}
+}
+
+func TestBackToBackWindowsDoNotOverlap(t *testing.T) {
+	a := time.Date(2017, 02, 02, 9, 0, 0, 0, time.UTC)
+	b := a.Add(time.Hour)
+	c := b.Add(time.Hour)
+
+	first := getMatch(10, 0, a, model.NotificationFilter{Until: b})["$match"].(bson.M)["lastModified"].(bson.M)
+	second := getMatch(10, 0, b, model.NotificationFilter{Until: c})["$match"].(bson.M)["lastModified"].(bson.M)
+
+	assert.Equal(t, second["$gt"], first["$lt"], "The first window should end where the second begins")
+	assert.Equal(t, findBetween(10, a, b, model.NotificationFilter{})["lastModified"].(bson.M)["$lte"], first["$lt"], "Counts should be bounded in the same way as reads")
+}
+
+func TestGetMatchWithFutureUntil(t *testing.T) {
+	since := time.Now().UTC()
+
+	match := getMatch(10, 0, since, model.NotificationFilter{Until: since.Add(time.Hour)})
+
+	lastModified := match["$match"].(bson.M)["lastModified"].(bson.M)
+	assert.True(t, lastModified["$lt"].(time.Time).Before(since), "The until date should not allow reading notifications within the cache delay")
+}
+
+func TestBackdatedNotificationIsReadAfterPagingPastItsDate(t *testing.T) {
+	policy, err := mapping.NewLastModifiedPolicy(60, mapping.ClampSkewPolicy, 10)
+	require.NoError(t, err)
+	mapper := mapping.DefaultMapper{ApiHost: "testing-123.com", LastModified: policy}
+
+	// the reader has read every notification so far, so its next page starts at the server time
+	since := time.Now().UTC()
+	backdated := since.Add(-time.Hour)
+
+	body := `{"uuid":"ef863741-709a-4062-a8f1-987c44db1db5","publishReference":"tid_backdated","lastModified":"` + backdated.Format(time.RFC3339Nano) + `"}`
+	notification, err := mapper.MapRequestToInternalNotification("ef863741-709a-4062-a8f1-987c44db1db5", json.NewDecoder(strings.NewReader(body)))
+	require.NoError(t, err)
+
+	lastModified := getMatch(10, 0, since, model.NotificationFilter{})["$match"].(bson.M)["lastModified"].(bson.M)
+	assert.True(t, backdated.Before(lastModified["$gt"].(time.Time)), "The reader should already have paged past the backdated date")
+	assert.True(t, notification.LastModified.After(lastModified["$gt"].(time.Time)), "The backdated notification should be read on a later page")
+	assert.Equal(t, backdated, notification.OriginalLastModified)
+}
+
 func TestQuery(t *testing.T) {
 	since, err := time.Parse(time.RFC3339Nano, "2016-10-26T16:15:09.46Z")
 	assert.NoError(t, err)
 	log := logger.NewUPPLogger("test", "debug")
 
-	query := generateQuery(10, 50, 102, since, log)
+	query := generateQuery(10, 50, 102, since, model.NotificationFilter{}, log)
 
-	regex := regexp.MustCompile(`\[\{"\$match":\{"lastModified":\{"\$gte":".*","\$lte":".*"}}},\{"\$sort":\{"lastModified":-1}},\{"\$group":\{"_id":"\$uuid","eventType":\{"\$first":"\$eventType"},"lastModified":\{"\$first":"\$lastModified"},"publishReference":\{"\$first":"\$publishReference"},"title":\{"\$first":"\$title"},"uuid":\{"\$first":"\$uuid"}}},\{"\$sort":\{"lastModified":1,"uuid":1}},\{"\$skip":50},\{"\$limit":103}]`)
+	regex := regexp.MustCompile(`\[\{"\$match":\{"lastModified":\{"\$gte":".*","\$lte":".*"}}},\{"\$match":\{"superseded":\{"\$ne":true}}},\{"\$sort":\{"lastModified":-1}},\{"\$group":\{"_id":"\$uuid","addedItems":\{"\$first":"\$addedItems"},"concept":\{"\$first":"\$concept"},"eventType":\{"\$first":"\$eventType"},"lastModified":\{"\$first":"\$lastModified"},"layoutHint":\{"\$first":"\$layoutHint"},"listType":\{"\$first":"\$listType"},"publishReference":\{"\$first":"\$publishReference"},"removedItems":\{"\$first":"\$removedItems"},"reordered":\{"\$first":"\$reordered"},"title":\{"\$first":"\$title"},"uuid":\{"\$first":"\$uuid"}}},\{"\$sort":\{"lastModified":1,"uuid":1}},\{"\$skip":50},\{"\$limit":103}]`)
 	data, err := json.Marshal(query)
 	assert.NoError(t, err)
 	assert.True(t, regex.MatchString(string(data)), "Query json should match!")
@@ -75,3 +156,190 @@ func TestFindNotificationQueryByPartialTXID(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Contains(t, string(data), `{"publishReference":{"$regex":"^tid_i-am-a-tid"}}`)
 }
+
+func TestFindNotificationQueryByPartialTXIDEscapesRegex(t *testing.T) {
+	query := findByPartialTransactionID("tid_.*|x")
+
+	data, err := json.Marshal(query)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"publishReference":{"$regex":"^tid_\\.\\*\\|x"}}`, string(data), "The transaction id should be matched literally")
+}
+
+func TestFindLatestCandidatesQuery(t *testing.T) {
+	query := findLatestCandidates("ef863741-709a-4062-a8f1-987c44db1db5")
+
+	data, err := json.Marshal(query)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"superseded":{"$ne":true},"uuid":"ef863741-709a-4062-a8f1-987c44db1db5"}`, string(data))
+}
+
+func TestFindRecordedQuery(t *testing.T) {
+	query := findRecorded("ef863741-709a-4062-a8f1-987c44db1db5", "tid_i-am-a-tid")
+
+	data, err := json.Marshal(query)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"publishReference":"tid_i-am-a-tid","uuid":"ef863741-709a-4062-a8f1-987c44db1db5"}`, string(data))
+}
+
+func TestCollapsedQueriesLeaveOutSupersededNotifications(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	since := time.Now().UTC().Add(-time.Hour)
+
+	for name, query := range map[string][]bson.M{
+		"offset":        generateQuery(10, 0, 10, since, model.NotificationFilter{}, log),
+		"cursor":        generateCursorQuery(10, 10, since, "uuid", "tid", model.NotificationFilter{}, log),
+		"export":        generateExportQuery(10, since, model.NotificationFilter{}, log),
+		"uncollapsed":   generateQuery(10, 0, 10, since, model.NotificationFilter{Uncollapsed: true}, log),
+		"history":       generateHistoryQuery(10, 0, 10, "uuid", since, time.Time{}, log),
+		"cursorHistory": generateHistoryCursorQuery(10, 10, "uuid", since, "tid", time.Time{}, log),
+	} {
+		data, err := json.Marshal(query)
+		assert.NoError(t, err)
+
+		collapsed := name == "offset" || name == "cursor" || name == "export"
+		assert.Equal(t, collapsed, strings.Contains(string(data), `{"$match":{"superseded":{"$ne":true}}}`), name)
+	}
+}
+
+func TestFindBetweenQuery(t *testing.T) {
+	since := time.Date(2017, 02, 02, 12, 51, 0, 0, time.UTC)
+	until := since.AddDate(0, 1, 0)
+
+	data, err := json.Marshal(findBetween(10, since, until, model.NotificationFilter{EventTypes: []string{"DELETE"}}))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"eventType":{"$in":["DELETE"]},"lastModified":{"$gt":"2017-02-02T12:50:50Z","$lte":"2017-03-02T12:50:50Z"}}`, string(data))
+}
+
+func TestFindDuplicatesQuery(t *testing.T) {
+	data, err := json.Marshal(findDuplicates())
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"$sort":{"_id":1}},{"$group":{"_id":{"publishReference":"$publishReference","uuid":"$uuid"},"count":{"$sum":1},"ids":{"$push":"$_id"}}},{"$match":{"count":{"$gt":1}}}]`, string(data))
+}
+
+func TestFindUnpublishedQuery(t *testing.T) {
+	data, err := json.Marshal(findUnpublished())
+	assert.NoError(t, err)
+	assert.Equal(t, `{"publishedAt":{"$exists":false}}`, string(data))
+}
+
+func TestFindRetryingQuery(t *testing.T) {
+	now := time.Date(2017, 02, 02, 12, 51, 0, 0, time.UTC)
+
+	data, err := json.Marshal(findRetrying(now))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"nextAttemptAt":{"$gt":"2017-02-02T12:51:00Z"},"publishedAt":{"$exists":false}}`, string(data))
+}
+
+func TestFindUnpublishedExceptQuery(t *testing.T) {
+	data, err := json.Marshal(findUnpublishedExcept(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"publishedAt":{"$exists":false}}`, string(data))
+
+	data, err = json.Marshal(findUnpublishedExcept([]string{"uuid1"}))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"notification.uuid":{"$nin":["uuid1"]},"publishedAt":{"$exists":false}}`, string(data))
+}
+
+func TestFindAvailableLeaseQuery(t *testing.T) {
+	now := time.Date(2017, 02, 02, 12, 51, 0, 0, time.UTC)
+
+	data, err := json.Marshal(findAvailableLease("outbox-dispatcher", "pod-1", now))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"$or":[{"owner":"pod-1"},{"expiresAt":{"$lt":"2017-02-02T12:51:00Z"}}],"_id":"outbox-dispatcher"}`, string(data))
+}
+
+func TestCursorQuery(t *testing.T) {
+	lastModified := time.Date(2017, 02, 02, 12, 51, 0, 0, time.UTC)
+	log := logger.NewUPPLogger("test", "debug")
+
+	query := generateCursorQuery(10, 102, lastModified, "ef863741-709a-4062-a8f1-987c44db1db5", "tid_1", model.NotificationFilter{}, log)
+	assert.Len(t, query, 7)
+
+	data, err := json.Marshal(query[0])
+	assert.NoError(t, err)
+	assert.Regexp(t, `^\{"\$match":\{"lastModified":\{"\$gte":"2017-02-02T12:51:00Z","\$lt":".*"}}}$`, string(data))
+
+	data, err = json.Marshal(query[4])
+	assert.NoError(t, err)
+	assert.Equal(t, `{"$match":{"$or":[{"lastModified":{"$gt":"2017-02-02T12:51:00Z"}},{"lastModified":"2017-02-02T12:51:00Z","uuid":{"$gt":"ef863741-709a-4062-a8f1-987c44db1db5"}}]}}`, string(data))
+
+	assert.Equal(t, bson.D{{Key: "lastModified", Value: 1}, {Key: "uuid", Value: 1}}, query[5]["$sort"], "The sort order must match the cursor")
+	assert.Equal(t, bson.M{"$limit": 103}, query[6])
+}
+
+func TestHistoryQuery(t *testing.T) {
+	since := time.Date(2017, 02, 02, 12, 51, 0, 0, time.UTC)
+	log := logger.NewUPPLogger("test", "debug")
+
+	query := generateHistoryQuery(10, 2, 50, "ef863741-709a-4062-a8f1-987c44db1db5", since, time.Time{}, log)
+	assert.Len(t, query, 4)
+
+	data, err := json.Marshal(query[0])
+	assert.NoError(t, err)
+	assert.Regexp(t, `^\{"\$match":\{"lastModified":\{"\$gte":"2017-02-02T12:50:50Z","\$lte":".*"},"uuid":\{"\$in":\["ef863741-709a-4062-a8f1-987c44db1db5"]}}}$`, string(data))
+
+	assert.Equal(t, bson.D{{Key: "lastModified", Value: 1}, {Key: "publishReference", Value: 1}}, query[1]["$sort"], "History should not be collapsed")
+	assert.Equal(t, bson.M{"$skip": 2}, query[2])
+	assert.Equal(t, bson.M{"$limit": 51}, query[3])
+}
+
+func TestHistoryCursorQuery(t *testing.T) {
+	lastModified := time.Date(2017, 02, 02, 12, 51, 0, 0, time.UTC)
+	log := logger.NewUPPLogger("test", "debug")
+
+	query := generateHistoryCursorQuery(10, 50, "ef863741-709a-4062-a8f1-987c44db1db5", lastModified, "tid_1", time.Time{}, log)
+	assert.Len(t, query, 3)
+
+	data, err := json.Marshal(query[0])
+	assert.NoError(t, err)
+	assert.Regexp(t, `^\{"\$match":\{"\$or":\[\{"lastModified":\{"\$gt":"2017-02-02T12:51:00Z"}},\{"lastModified":"2017-02-02T12:51:00Z","publishReference":\{"\$gt":"tid_1"}}],"lastModified":\{"\$gte":"2017-02-02T12:51:00Z","\$lt":".*"},"uuid":"ef863741-709a-4062-a8f1-987c44db1db5"}}$`, string(data))
+	assert.Equal(t, bson.M{"$limit": 51}, query[2])
+}
+
+func TestUncollapsedQuery(t *testing.T) {
+	since, err := time.Parse(time.RFC3339Nano, "2016-10-26T16:15:09.46Z")
+	assert.NoError(t, err)
+	log := logger.NewUPPLogger("test", "debug")
+
+	query := generateQuery(10, 50, 102, since, model.NotificationFilter{Uncollapsed: true}, log)
+	assert.Len(t, query, 4, "The notifications should not be grouped by uuid")
+
+	assert.Contains(t, query[0], "$match")
+	assert.Equal(t, bson.D{{Key: "lastModified", Value: 1}, {Key: "uuid", Value: 1}, {Key: "publishReference", Value: 1}}, query[1]["$sort"])
+	assert.Equal(t, bson.M{"$skip": 50}, query[2])
+	assert.Equal(t, bson.M{"$limit": 103}, query[3])
+}
+
+func TestUncollapsedCursorQuery(t *testing.T) {
+	lastModified := time.Date(2017, 02, 02, 12, 51, 0, 0, time.UTC)
+	log := logger.NewUPPLogger("test", "debug")
+
+	query := generateCursorQuery(10, 102, lastModified, "ef863741-709a-4062-a8f1-987c44db1db5", "tid_1", model.NotificationFilter{Uncollapsed: true}, log)
+	assert.Len(t, query, 4)
+
+	data, err := json.Marshal(query[1])
+	assert.NoError(t, err)
+	assert.Equal(t, `{"$match":{"$or":[{"lastModified":{"$gt":"2017-02-02T12:51:00Z"}},{"lastModified":"2017-02-02T12:51:00Z","uuid":{"$gt":"ef863741-709a-4062-a8f1-987c44db1db5"}},{"lastModified":"2017-02-02T12:51:00Z","publishReference":{"$gt":"tid_1"},"uuid":"ef863741-709a-4062-a8f1-987c44db1db5"}]}}`, string(data))
+
+	assert.Equal(t, bson.D{{Key: "lastModified", Value: 1}, {Key: "uuid", Value: 1}, {Key: "publishReference", Value: 1}}, query[2]["$sort"], "The sort order must match the cursor")
+	assert.Equal(t, bson.M{"$limit": 103}, query[3])
+}
+
+func TestExportQuery(t *testing.T) {
+	since := time.Date(2017, 02, 02, 12, 51, 0, 0, time.UTC)
+	until := since.AddDate(0, 1, 0)
+	log := logger.NewUPPLogger("test", "debug")
+
+	query := generateExportQuery(10, since, model.NotificationFilter{Until: until}, log)
+	assert.Len(t, query, 5)
+
+	data, err := json.Marshal(query[0])
+	assert.NoError(t, err)
+	assert.Equal(t, `{"$match":{"lastModified":{"$gte":"2017-02-02T12:51:00Z","$lt":"2017-03-02T12:51:00Z"}}}`, string(data), "The export should not be shifted by the cache delay")
+	assert.Contains(t, query[3], "$group")
+	assert.Equal(t, bson.D{{Key: "lastModified", Value: 1}, {Key: "uuid", Value: 1}}, query[4]["$sort"])
+
+	raw := generateExportQuery(10, since, model.NotificationFilter{Until: until, Uncollapsed: true}, log)
+	assert.Len(t, raw, 2)
+	assert.Equal(t, uncollapsedSort(), raw[1])
+}
@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/Financial-Times/list-notifications-rw/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const webhookLeaseID = "webhook-dispatcher"
+
+// CreateSubscription inserts the webhook subscription
+func (c *Client) CreateSubscription(subscription model.Subscription) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	_, err := c.subscriptions().InsertOne(ctx, subscription)
+	return err
+}
+
+// ReadSubscriptions reads every webhook subscription, oldest first
+func (c *Client) ReadSubscriptions() ([]model.Subscription, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+
+	cursor, err := c.subscriptions().Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptions := []model.Subscription{}
+	if err = cursor.All(ctx, &subscriptions); err != nil {
+		return nil, err
+	}
+	return subscriptions, nil
+}
+
+// FindSubscription reads the webhook subscription with the id, returning mongo.ErrNoDocuments if there is none
+func (c *Client) FindSubscription(id string) (model.Subscription, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	var subscription model.Subscription
+	err := c.subscriptions().FindOne(ctx, bson.M{"_id": id}).Decode(&subscription)
+	return subscription, err
+}
+
+// UpdateSubscription replaces the callback url and filters of the webhook subscription, keeping its secret if the
+// update has none. Any pending retry is cancelled, so the next delivery goes to the new callback url straight away.
+func (c *Client) UpdateSubscription(subscription model.Subscription) error {
+	set := bson.M{
+		"callbackUrl":            subscription.CallbackURL,
+		"uuids":                  subscription.UUIDs,
+		"types":                  subscription.Types,
+		"delivery.attempts":      0,
+		"delivery.nextAttemptAt": time.Time{},
+	}
+	if subscription.Secret != "" {
+		set["secret"] = subscription.Secret
+	}
+
+	return c.updateSubscription(subscription.ID, bson.M{"$set": set})
+}
+
+// UpdateSubscriptionDelivery records the progress of delivering notifications to the webhook subscription
+func (c *Client) UpdateSubscriptionDelivery(id string, delivery model.SubscriptionDelivery) error {
+	return c.updateSubscription(id, bson.M{"$set": bson.M{"delivery": delivery}})
+}
+
+func (c *Client) updateSubscription(id string, update bson.M) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	result, err := c.subscriptions().UpdateByID(ctx, id, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// DeleteSubscription removes the webhook subscription, returning mongo.ErrNoDocuments if there is none
+func (c *Client) DeleteSubscription(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	result, err := c.subscriptions().DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// WriteDeadLetter records a notification which could not be delivered to a webhook subscription
+func (c *Client) WriteDeadLetter(deadLetter model.DeadLetter) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	deadLetters := c.client.Database(c.database).Collection(c.subscriptionsCollection + "-dead-letters")
+	_, err := deadLetters.InsertOne(ctx, deadLetter)
+	return err
+}
+
+// AcquireWebhookLease takes or renews the lease for delivering webhooks, so only one instance delivers at a time.
+// It returns false if another owner holds an unexpired lease.
+func (c *Client) AcquireWebhookLease(owner string, ttl time.Duration) (bool, error) {
+	return c.acquireLease(c.subscriptionsCollection+"-lease", webhookLeaseID, owner, ttl)
+}
+
+func (c *Client) subscriptions() *mongo.Collection {
+	return c.client.Database(c.database).Collection(c.subscriptionsCollection)
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/Financial-Times/api-endpoint"
@@ -10,7 +13,9 @@ import (
 	"github.com/Financial-Times/http-handlers-go/httphandlers"
 	"github.com/Financial-Times/list-notifications-rw/db"
 	"github.com/Financial-Times/list-notifications-rw/mapping"
+	"github.com/Financial-Times/list-notifications-rw/outbox"
 	"github.com/Financial-Times/list-notifications-rw/resources"
+	"github.com/Financial-Times/list-notifications-rw/webhook"
 	status "github.com/Financial-Times/service-status-go/httphandlers"
 	"github.com/gorilla/mux"
 	"github.com/jawher/mow.cli"
@@ -80,6 +85,41 @@ func main() {
 		EnvVar: "NOTIFICATIONS_LIMIT",
 	})
 
+	lastModifiedMaxSkew := app.Int(cli.IntOpt{
+		Name:   "last-modified-max-skew",
+		Desc:   "The max number of seconds a list's lastModified date may be ahead of the server time. Set to 0 to disable the check.",
+		Value:  60,
+		EnvVar: "LAST_MODIFIED_MAX_SKEW",
+	})
+
+	lastModifiedSkewPolicy := app.String(cli.StringOpt{
+		Name:   "last-modified-skew-policy",
+		Desc:   "What to do with lists whose lastModified date is beyond the max skew (clamp, reject). Clamping replaces the date with the server time.",
+		Value:  mapping.ClampSkewPolicy,
+		EnvVar: "LAST_MODIFIED_SKEW_POLICY",
+	})
+
+	maxStreams := app.Int(cli.IntOpt{
+		Name:   "max-streams",
+		Value:  100,
+		Desc:   "The max number of concurrent notification streams on each instance.",
+		EnvVar: "MAX_STREAMS",
+	})
+
+	pagination := app.String(cli.StringOpt{
+		Name:   "pagination",
+		Value:  "offset",
+		Desc:   "How next links page through notifications (offset, cursor). Links using since and offset are always accepted.",
+		EnvVar: "PAGINATION",
+	})
+
+	cursorSecret := app.String(cli.StringOpt{
+		Name:   "cursor-secret",
+		Value:  "",
+		Desc:   "Secret used to sign cursors, required for cursor pagination",
+		EnvVar: "CURSOR_SECRET",
+	})
+
 	apiYml := app.String(cli.StringOpt{
 		Name:   "api-yml",
 		Value:  "./api.yml",
@@ -129,13 +169,103 @@ func main() {
 		EnvVar: "DB_PASSWORD",
 	})
 
+	outboxPublisher := app.String(cli.StringOpt{
+		Name:   "outbox-publisher",
+		Value:  "",
+		Desc:   "Where to publish list notifications as they are written (kafka, file). Leave empty to disable the outbox.",
+		EnvVar: "OUTBOX_PUBLISHER",
+	})
+
+	outboxCollection := app.String(cli.StringOpt{
+		Name:   "outbox-collection",
+		Value:  "list-notifications-outbox",
+		Desc:   "Name of the collection used as the outbox for notifications waiting to be published",
+		EnvVar: "OUTBOX_COLLECTION",
+	})
+
+	outboxFile := app.String(cli.StringOpt{
+		Name:   "outbox-file",
+		Value:  "",
+		Desc:   "File the file outbox publisher appends to. Leave empty to write to stdout.",
+		EnvVar: "OUTBOX_FILE",
+	})
+
+	outboxMaxBacklogAge := app.Int(cli.IntOpt{
+		Name:   "outbox-max-backlog-age",
+		Value:  300,
+		Desc:   "The max age in seconds of the oldest unpublished outbox message before the healthcheck fails.",
+		EnvVar: "OUTBOX_MAX_BACKLOG_AGE",
+	})
+
+	webhooksEnabled := app.Bool(cli.BoolOpt{
+		Name:   "webhooks-enabled",
+		Value:  false,
+		Desc:   "Enables webhook subscriptions, and delivers notifications to them.",
+		EnvVar: "WEBHOOKS_ENABLED",
+	})
+
+	subscriptionsCollection := app.String(cli.StringOpt{
+		Name:   "subscriptions-collection",
+		Value:  "list-notifications-subscriptions",
+		Desc:   "Name of the collection webhook subscriptions are stored in",
+		EnvVar: "SUBSCRIPTIONS_COLLECTION",
+	})
+
+	webhookMaxAttempts := app.Int(cli.IntOpt{
+		Name:   "webhook-max-attempts",
+		Value:  10,
+		Desc:   "The number of attempts to deliver a notification to a webhook before it is dead lettered.",
+		EnvVar: "WEBHOOK_MAX_ATTEMPTS",
+	})
+
+	kafkaBrokers := app.String(cli.StringOpt{
+		Name:   "kafka-brokers",
+		Value:  "",
+		Desc:   "Comma separated list of Kafka brokers for the kafka outbox publisher",
+		EnvVar: "KAFKA_BROKERS",
+	})
+
+	kafkaTopic := app.String(cli.StringOpt{
+		Name:   "kafka-topic",
+		Value:  "ListNotifications",
+		Desc:   "Kafka topic the kafka outbox publisher writes to",
+		EnvVar: "KAFKA_TOPIC",
+	})
+
 	log := logger.NewUPPLogger(*appName, *logLevel)
 
+	app.Command("dedupe", "Removes duplicate notifications (with the same uuid and publishReference), builds the unique index, then exits. Run it once, rather than on every instance.", func(cmd *cli.Cmd) {
+		cmd.Action = func() {
+			client, err := db.NewClient(*dbClusterAddress, *dbUsername, *dbPassword, *dbName, *dbCollection, "", *subscriptionsCollection, *cacheMaxAge, *limit, log)
+			if err == nil {
+				err = dedupeNotifications(client, log)
+				if closeErr := client.Close(); closeErr != nil {
+					log.WithError(closeErr).Error("Failed to close connection to DB")
+				}
+			}
+			if err != nil {
+				log.WithError(err).Error("Failed to dedupe notifications")
+				cli.Exit(1)
+			}
+		}
+	})
+
 	app.Action = func() {
 		log.Infof("System code: %s, App Name: %s, Port: %s", *appSystemCode, *appName, *port)
 
 		log.Info("Initialising database connection.")
-		client, err := db.NewClient(*dbClusterAddress, *dbUsername, *dbPassword, *dbName, *dbCollection, *cacheMaxAge, *limit, log)
+		publisher, err := newOutboxPublisher(*outboxPublisher, *outboxFile, *kafkaBrokers, *kafkaTopic)
+		if err != nil {
+			log.WithError(err).Error("Failed to create outbox publisher")
+			return
+		}
+
+		dbOutboxCollection := ""
+		if publisher != nil {
+			dbOutboxCollection = *outboxCollection
+		}
+
+		client, err := db.NewClient(*dbClusterAddress, *dbUsername, *dbPassword, *dbName, *dbCollection, dbOutboxCollection, *subscriptionsCollection, *cacheMaxAge, *limit, log)
 		if err != nil {
 			log.WithError(err).Error("Failed to create database client")
 			return
@@ -154,17 +284,85 @@ func main() {
 		}
 		log.Info("Finished ensuring indices.")
 
-		mapper := mapping.DefaultMapper{ApiHost: *apiHost}
+		// the unique index may take a long time to build, and cannot be built while duplicate notifications are stored,
+		// so it is built in the background, and the healthcheck fails until it exists
+		go func() {
+			if err := client.EnsureUniqueIndex(); err != nil {
+				log.WithError(err).Error("Failed to ensure the unique notifications index! If duplicate notifications are stored, run the dedupe command once to remove them.")
+				return
+			}
+			log.Info("Finished ensuring the unique notifications index.")
+		}()
+
+		lastModifiedPolicy, err := mapping.NewLastModifiedPolicy(*lastModifiedMaxSkew, *lastModifiedSkewPolicy, *cacheMaxAge)
+		if err != nil {
+			log.WithError(err).Error("Invalid lastModified policy")
+			return
+		}
+
+		mapper := mapping.DefaultMapper{ApiHost: *apiHost, LastModified: lastModifiedPolicy}
 
-		nextLink := mapping.OffsetNextLink{
-			ApiHost:    *apiHost,
-			CacheDelay: *cacheMaxAge,
-			MaxLimit:   *limit,
+		nextLink, err := newNextLinkGenerator(*pagination, *cursorSecret, *apiHost, *cacheMaxAge, *limit)
+		if err != nil {
+			log.WithError(err).Error("Invalid pagination")
+			return
 		}
 
 		healthService := resources.NewHealthService(client, *appSystemCode, *appName, appDescription)
+		healthService.AddUniqueIndexCheck(client)
+
+		if publisher != nil {
+			defer func() {
+				if err = publisher.Close(); err != nil {
+					log.WithError(err).Error("Failed to close outbox publisher")
+				}
+			}()
+
+			owner, _ := os.Hostname()
+			dispatcher := outbox.NewDispatcher(outbox.Config{
+				Owner:        owner,
+				PollInterval: time.Second,
+				BatchSize:    100,
+				MinBackoff:   time.Second,
+				MaxBackoff:   5 * time.Minute,
+			}, client, publisher, mapper, log)
+
+			log.Infof("Publishing list notifications from the outbox with the %s publisher.", *outboxPublisher)
+			dispatcher.Start()
+			defer dispatcher.Stop()
+
+			healthService.AddOutboxBacklogCheck(client, time.Duration(*outboxMaxBacklogAge)*time.Second)
+		}
+
+		if *webhooksEnabled {
+			owner, _ := os.Hostname()
+			dispatcher := webhook.NewDispatcher(webhook.Config{
+				Owner:        owner,
+				PollInterval: time.Second,
+				CacheDelay:   *cacheMaxAge,
+				MinBackoff:   time.Second,
+				MaxBackoff:   time.Hour,
+				MaxAttempts:  *webhookMaxAttempts,
+				Timeout:      10 * time.Second,
+			}, client, webhook.NewClient(), mapper, log)
+
+			log.Info("Delivering list notifications to webhook subscriptions.")
+			dispatcher.Start()
+			defer dispatcher.Stop()
+		}
+
+		notifier := resources.NewNotifier(*cacheMaxAge)
 
-		startService(apiYml, *port, *maxSinceInterval, *dumpRequests, healthService, mapper, nextLink, client, log)
+		streamConfig := resources.StreamConfig{
+			MaxStreams:       *maxStreams,
+			MaxSinceInterval: *maxSinceInterval,
+			CacheDelay:       *cacheMaxAge,
+			Heartbeat:        15 * time.Second,
+			PollInterval:     5 * time.Second,
+			WriteTimeout:     10 * time.Second,
+		}
+
+		startService(apiYml, *port, *maxSinceInterval, *cacheMaxAge, *dumpRequests, *webhooksEnabled, healthService, mapper, nextLink, notifier, streamConfig, client, log)
 	}
 
 	if err := app.Run(os.Args); err != nil {
@@ -173,14 +371,65 @@ func main() {
 	}
 }
 
+// dedupeNotifications removes the duplicate notifications which prevent the unique index being built, then builds it
+func dedupeNotifications(client *db.Client, log *logger.UPPLogger) error {
+	log.Info("Removing duplicate notifications...")
+	removed, err := client.RemoveDuplicateNotifications()
+	if err != nil {
+		return err
+	}
+	log.WithField("removed", removed).Info("Finished removing duplicate notifications.")
+
+	log.Info("Building the unique notifications index...")
+	if err = client.EnsureUniqueIndex(); err != nil {
+		return err
+	}
+	log.Info("Finished building the unique notifications index.")
+	return nil
+}
+
+func newOutboxPublisher(kind, file, brokers, topic string) (outbox.Publisher, error) {
+	switch kind {
+	case "":
+		return nil, nil
+	case "file":
+		return outbox.NewFilePublisher(file)
+	case "kafka":
+		if strings.TrimSpace(brokers) == "" {
+			return nil, errors.New("kafka-brokers must be set for the kafka outbox publisher")
+		}
+		return outbox.NewKafkaPublisher(strings.Split(brokers, ","), topic), nil
+	default:
+		return nil, fmt.Errorf("unknown outbox publisher %q", kind)
+	}
+}
+
+func newNextLinkGenerator(kind, secret, apiHost string, cacheDelay, limit int) (mapping.NextLinkGenerator, error) {
+	switch kind {
+	case "offset":
+		return mapping.OffsetNextLink{ApiHost: apiHost, CacheDelay: cacheDelay, MaxLimit: limit}, nil
+	case "cursor":
+		if secret == "" {
+			return nil, errors.New("cursor-secret must be set for cursor pagination")
+		}
+		return mapping.CursorNextLink{ApiHost: apiHost, CacheDelay: cacheDelay, MaxLimit: limit, Secret: []byte(secret)}, nil
+	default:
+		return nil, fmt.Errorf("unknown pagination %q", kind)
+	}
+}
+
 func startService(
 	apiYml *string,
 	port string,
 	maxSinceInterval int,
+	cacheDelay int,
 	dumpRequests bool,
+	webhooksEnabled bool,
 	healthService *resources.HealthService,
 	mapper mapping.NotificationsMapper,
 	nextLink mapping.NextLinkGenerator,
+	notifier *resources.Notifier,
+	streamConfig resources.StreamConfig,
 	db *db.Client,
 	log *logger.UPPLogger,
 ) {
@@ -191,6 +440,14 @@ func startService(
 	monitoringRouter = httphandlers.TransactionAwareRequestLoggingHandler(log, monitoringRouter)
 	monitoringRouter = httphandlers.HTTPMetricsHandler(metrics.DefaultRegistry, monitoringRouter)
 
+	// streams and exports bypass the request logging handler, as it hides the connection's write deadline, which they must extend
+	stream := resources.StreamNotifications(mapper, db, notifier, streamConfig, log)
+	export := resources.ExportNotifications(mapper, db, log)
+	root := mux.NewRouter()
+	root.Handle("/lists/notifications/stream", httphandlers.HTTPMetricsHandler(metrics.DefaultRegistry, http.HandlerFunc(stream))).Methods("GET")
+	root.Handle("/lists/notifications/export", httphandlers.HTTPMetricsHandler(metrics.DefaultRegistry, http.HandlerFunc(export))).Methods("GET")
+	root.PathPrefix("/").Handler(monitoringRouter)
+
 	if apiYml != nil {
 		apiEndpoint, err := api.NewAPIEndpointForFile(*apiYml)
 		if err != nil {
@@ -200,11 +457,31 @@ func startService(
 		}
 	}
 
-	r.HandleFunc("/lists/notifications", resources.ReadNotifications(mapper, nextLink, db, maxSinceInterval, log))
+	r.HandleFunc("/lists/notifications", resources.ReadNotifications(mapper, nextLink, db, notifier, maxSinceInterval, cacheDelay, log))
+
+	r.HandleFunc("/lists/{uuid}/notifications", resources.ReadHistory(mapper, nextLink, db, cacheDelay, log)).Methods("GET")
+
+	r.HandleFunc("/lists/notifications/by-transaction/{tid}", resources.ReadNotificationsByTransactionID(mapper, db, log)).Methods("GET")
 
-	write := resources.Filter(resources.WriteNotification(dumpRequests, mapper, db, log), log).FilterSyntheticTransactions().FilterCarouselPublishes(db).Gunzip().Build()
+	writer := resources.NewNotifyingWriter(db, notifier)
+
+	write := resources.Filter(resources.WriteNotification(dumpRequests, mapper, writer, log), log).FilterSyntheticTransactions().FilterCarouselPublishes(db).Gunzip().Build()
 	r.HandleFunc("/lists/{uuid}", write).Methods("PUT")
 
+	remove := resources.Filter(resources.DeleteNotification(dumpRequests, mapper, writer, log), log).FilterSyntheticTransactions().FilterCarouselPublishes(db).Gunzip().Build()
+	r.HandleFunc("/lists/{uuid}", remove).Methods("DELETE")
+
+	batch := resources.Filter(resources.BatchWriteNotifications(dumpRequests, mapper, writer, log), log).FilterSyntheticTransactions().Gunzip().Build()
+	r.HandleFunc("/lists/notifications/batch", batch).Methods("POST")
+
+	if webhooksEnabled {
+		r.HandleFunc("/__subscriptions", resources.CreateSubscription(db, cacheDelay, log)).Methods("POST")
+		r.HandleFunc("/__subscriptions", resources.ReadSubscriptions(db, log)).Methods("GET")
+		r.HandleFunc("/__subscriptions/{id}", resources.ReadSubscription(db, log)).Methods("GET")
+		r.HandleFunc("/__subscriptions/{id}", resources.UpdateSubscription(db, log)).Methods("PUT")
+		r.HandleFunc("/__subscriptions/{id}", resources.DeleteSubscription(db, log)).Methods("DELETE")
+	}
+
 	r.HandleFunc("/__health", healthService.HealthChecksHandler())
 
 	r.HandleFunc("/__log", resources.UpdateLogLevel(log)).Methods("POST")
@@ -219,7 +496,7 @@ func startService(
 
 	addr := ":" + port
 	server := &http.Server{
-		Handler: monitoringRouter,
+		Handler: root,
 		Addr:    addr,
 
 		WriteTimeout: 60 * time.Second,
@@ -0,0 +1,128 @@
+package mapping
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Financial-Times/list-notifications-rw/model"
+)
+
+// CursorParam is the query parameter which carries the cursor in links generated by CursorNextLink
+const CursorParam = "cursor"
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is the position of the last notification on a page; the next page starts after it.
+// The publishReference orders notifications for the same list which were last modified at the same time.
+type Cursor struct {
+	LastModified     time.Time `json:"t"`
+	UUID             string    `json:"u"`
+	PublishReference string    `json:"p,omitempty"`
+}
+
+// CursorParser is implemented by NextLinkGenerators whose links carry a cursor.
+type CursorParser interface {
+	ParseCursor(cursor string) (Cursor, error)
+}
+
+// CursorNextLink is a NextLinkGenerator which generates links carrying an opaque, signed cursor, rather than since and offset.
+// Pages which are requested with a since date (i.e. the first page) are still supported.
+type CursorNextLink struct {
+	ApiHost    string
+	CacheDelay int
+	MaxLimit   int
+	Secret     []byte
+	Path       string // The path of the next links; empty means /lists/notifications.
+}
+
+// NextLink given the since date or cursor, and until date from the original incoming request, and the notifications read from the db, return the 'next' link.
+// If there were no notifications, the link repeats the original request's cursor or since date.
+func (c CursorNextLink) NextLink(since time.Time, until time.Time, offset int, limit int, notifications []model.InternalNotification, params url.Values) (model.Link, bool) {
+	if len(notifications) == 0 && params.Get(CursorParam) == "" {
+		return c.offsetNextLink().NextLink(since, until, offset, limit, notifications, params)
+	}
+
+	c.MaxLimit = PageLimit(limit, c.MaxLimit) // the last notification on the page depends on the size of the requested page
+
+	if isLastPage(until, c.CacheDelay, c.MaxLimit, notifications) {
+		return model.Link{}, false
+	}
+
+	carried := withUntil(params, until)
+
+	if len(notifications) > 0 {
+		last := notifications[min(len(notifications), c.MaxLimit)-1]
+		if reachesUntil(last.LastModified.Add(time.Duration(c.CacheDelay)*time.Second), until) {
+			return model.Link{}, false
+		}
+		carried.Set(CursorParam, c.encode(Cursor{LastModified: last.LastModified.UTC(), UUID: last.UUID, PublishReference: last.PublishReference}))
+	}
+
+	uri := url.URL{}
+	uri.Scheme = "http"
+	uri.Host = c.ApiHost
+	uri.Path = linkPath(c.Path)
+	uri.RawQuery = carried.Encode()
+
+	return model.Link{
+		Href: uri.String(),
+		Rel:  "next",
+	}, true
+}
+
+// ProcessRequestLink sets the scheme and host of the request link
+func (c CursorNextLink) ProcessRequestLink(uri *url.URL) *url.URL {
+	return c.offsetNextLink().ProcessRequestLink(uri)
+}
+
+// WithPath returns a copy of the generator whose next links are to the given path
+func (c CursorNextLink) WithPath(path string) NextLinkGenerator {
+	c.Path = path
+	return c
+}
+
+// ParseCursor verifies and decodes a cursor generated by NextLink
+func (c CursorNextLink) ParseCursor(cursor string) (Cursor, error) {
+	payload, signature, found := strings.Cut(cursor, ".")
+	if !found {
+		return Cursor{}, errInvalidCursor
+	}
+
+	expected, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(expected, c.sign(payload)) {
+		return Cursor{}, errInvalidCursor
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return Cursor{}, errInvalidCursor
+	}
+
+	var decoded Cursor
+	if err = json.Unmarshal(data, &decoded); err != nil || decoded.UUID == "" {
+		return Cursor{}, errInvalidCursor
+	}
+	return decoded, nil
+}
+
+func (c CursorNextLink) encode(cursor Cursor) string {
+	data, _ := json.Marshal(cursor)
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(c.sign(payload))
+}
+
+func (c CursorNextLink) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, c.Secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+func (c CursorNextLink) offsetNextLink() OffsetNextLink {
+	return OffsetNextLink{ApiHost: c.ApiHost, CacheDelay: c.CacheDelay, MaxLimit: c.MaxLimit, Path: c.Path}
+}
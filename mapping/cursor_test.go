@@ -0,0 +1,107 @@
+package mapping
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/list-notifications-rw/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var cursorLink = CursorNextLink{ApiHost: "go-tests.ft.com", MaxLimit: 2, CacheDelay: 10, Secret: []byte("secret")}
+
+func TestCursorNextLinkRoundTrip(t *testing.T) {
+	now := time.Now().UTC()
+	notifications := []model.InternalNotification{
+		{UUID: "a", LastModified: now.Add(-2 * time.Second)},
+		{UUID: "b", LastModified: now.Add(-1 * time.Second), PublishReference: "tid_b"},
+		{UUID: "c", LastModified: now}, // the look-ahead notification, which is not on this page
+	}
+
+	link, _ := cursorLink.NextLink(now.Add(-time.Minute), time.Time{}, 0, 0, notifications, url.Values{"itemChanges": []string{"true"}})
+	assert.Equal(t, "next", link.Rel)
+
+	uri, err := url.Parse(link.Href)
+	require.NoError(t, err)
+	assert.Equal(t, "/lists/notifications", uri.Path)
+	assert.Equal(t, "true", uri.Query().Get("itemChanges"))
+	assert.Empty(t, uri.Query().Get("since"))
+	assert.Empty(t, uri.Query().Get("offset"))
+
+	cursor, err := cursorLink.ParseCursor(uri.Query().Get(CursorParam))
+	require.NoError(t, err)
+	assert.Equal(t, "b", cursor.UUID)
+	assert.Equal(t, "tid_b", cursor.PublishReference)
+	assert.True(t, now.Add(-1*time.Second).Equal(cursor.LastModified))
+}
+
+func TestCursorNextLinkRepeatsCursorWhenEmpty(t *testing.T) {
+	link, _ := cursorLink.NextLink(time.Now(), time.Time{}, 0, 0, nil, url.Values{CursorParam: []string{"the-cursor"}})
+
+	uri, err := url.Parse(link.Href)
+	require.NoError(t, err)
+	assert.Equal(t, "the-cursor", uri.Query().Get(CursorParam))
+}
+
+func TestCursorNextLinkFallsBackToSinceWhenEmpty(t *testing.T) {
+	since := time.Now().UTC()
+	link, _ := cursorLink.NextLink(since, time.Time{}, 0, 0, nil, nil)
+
+	uri, err := url.Parse(link.Href)
+	require.NoError(t, err)
+	assert.Equal(t, since.Format(time.RFC3339Nano), uri.Query().Get("since"))
+	assert.Empty(t, uri.Query().Get(CursorParam))
+}
+
+func TestParseCursorRejectsTampering(t *testing.T) {
+	encoded := cursorLink.encode(Cursor{LastModified: time.Now().UTC(), UUID: "a"})
+
+	other := CursorNextLink{Secret: []byte("another-secret")}
+	_, err := other.ParseCursor(encoded)
+	assert.Error(t, err, "Cursors signed with another secret should be rejected")
+
+	forged := other.encode(Cursor{LastModified: time.Now().UTC(), UUID: "b"})
+	_, err = cursorLink.ParseCursor(forged)
+	assert.Error(t, err)
+
+	for _, junk := range []string{"", "no-signature", "not.base64!", "." + encoded} {
+		_, err = cursorLink.ParseCursor(junk)
+		assert.Error(t, err, junk)
+	}
+}
+
+func TestCursorNextLinkWithUntil(t *testing.T) {
+	until := time.Now().UTC().Add(-time.Hour)
+	notifications := []model.InternalNotification{{UUID: "a", LastModified: until.Add(-time.Minute)}}
+
+	_, ok := cursorLink.NextLink(until.Add(-time.Hour), until, 0, 0, notifications, url.Values{CursorParam: []string{"the-cursor"}})
+	assert.False(t, ok, "The last page of a closed window should have no next link")
+
+	link, ok := cursorLink.NextLink(until.Add(-time.Hour), until, 0, 0, append(notifications, notifications[0], notifications[0]), nil)
+	require.True(t, ok)
+	uri, err := url.Parse(link.Href)
+	require.NoError(t, err)
+	assert.Equal(t, until.Format(time.RFC3339Nano), uri.Query().Get("until"))
+}
+
+func TestCursorNextLinkStopsAtUntil(t *testing.T) {
+	until := time.Now().UTC().Add(time.Hour)
+	notifications := []model.InternalNotification{{UUID: "a", LastModified: until.Add(-5 * time.Second)}}
+
+	_, ok := cursorLink.NextLink(until.Add(-time.Hour), until, 0, 0, append(notifications, notifications[0], notifications[0]), nil)
+	assert.False(t, ok, "A next link whose position is not before the until date could not be followed")
+}
+
+func TestCursorNextLinkWithPath(t *testing.T) {
+	notifications := []model.InternalNotification{{UUID: "a", LastModified: time.Now().UTC()}}
+
+	link, _ := cursorLink.WithPath("/lists/a/notifications").NextLink(time.Now(), time.Time{}, 0, 0, notifications, nil)
+
+	uri, err := url.Parse(link.Href)
+	require.NoError(t, err)
+	assert.Equal(t, "/lists/a/notifications", uri.Path)
+	_, isParser := cursorLink.WithPath("/lists/a/notifications").(CursorParser)
+	assert.True(t, isParser, "Cursors should still be parsed for other paths")
+}
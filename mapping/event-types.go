@@ -0,0 +1,61 @@
+package mapping
+
+import (
+	"fmt"
+	"strings"
+)
+
+const thingChangeTypePrefix = "http://www.ft.com/thing/ThingChangeType/"
+
+// The event types which can be stored against a list notification.
+const (
+	CreateEventType = "CREATE"
+	UpdateEventType = "UPDATE"
+	DeleteEventType = "DELETE"
+)
+
+// eventTypes is the registry of stored eventType values and their public ThingChangeType URIs.
+var eventTypes = map[string]string{
+	CreateEventType: thingChangeTypePrefix + CreateEventType,
+	UpdateEventType: thingChangeTypePrefix + UpdateEventType,
+	DeleteEventType: thingChangeTypePrefix + DeleteEventType,
+}
+
+// UnknownEventTypeError is returned when a stored eventType is not present in the registry.
+type UnknownEventTypeError struct {
+	EventType string
+}
+
+func (e UnknownEventTypeError) Error() string {
+	return fmt.Sprintf("unknown event type %q", e.EventType)
+}
+
+// PublicEventType returns the public ThingChangeType URI for the stored eventType.
+// Stored values which are already a known ThingChangeType URI are returned as is.
+func PublicEventType(eventType string) (string, error) {
+	if uri, ok := eventTypes[eventType]; ok {
+		return uri, nil
+	}
+
+	if strings.HasPrefix(eventType, thingChangeTypePrefix) {
+		if _, ok := eventTypes[strings.TrimPrefix(eventType, thingChangeTypePrefix)]; ok {
+			return eventType, nil
+		}
+	}
+
+	return "", UnknownEventTypeError{EventType: eventType}
+}
+
+// StoredEventTypes returns the stored eventType values which match the given event type. The event type may be given
+// either as the stored value (case insensitive) or as its public ThingChangeType URI; both forms are returned, as
+// notifications may have been stored with either.
+func StoredEventTypes(eventType string) ([]string, error) {
+	name := strings.ToUpper(strings.TrimPrefix(eventType, thingChangeTypePrefix))
+
+	uri, ok := eventTypes[name]
+	if !ok {
+		return nil, UnknownEventTypeError{EventType: eventType}
+	}
+
+	return []string{name, uri}, nil
+}
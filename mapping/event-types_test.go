@@ -0,0 +1,46 @@
+package mapping
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublicEventType(t *testing.T) {
+	tests := map[string]string{
+		"CREATE": "http://www.ft.com/thing/ThingChangeType/CREATE",
+		"UPDATE": "http://www.ft.com/thing/ThingChangeType/UPDATE",
+		"DELETE": "http://www.ft.com/thing/ThingChangeType/DELETE",
+		"http://www.ft.com/thing/ThingChangeType/UPDATE": "http://www.ft.com/thing/ThingChangeType/UPDATE",
+	}
+
+	for eventType, expected := range tests {
+		actual, err := PublicEventType(eventType)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, actual, "Unexpected public type for %s", eventType)
+	}
+}
+
+func TestPublicEventTypeUnknown(t *testing.T) {
+	for _, eventType := range []string{"", "update", "PUBLISH", "http://www.ft.com/thing/ThingChangeType/PUBLISH"} {
+		_, err := PublicEventType(eventType)
+
+		var unknown UnknownEventTypeError
+		assert.True(t, errors.As(err, &unknown), "Should be an unknown event type error for %q", eventType)
+		assert.Equal(t, eventType, unknown.EventType)
+	}
+}
+
+func TestStoredEventTypes(t *testing.T) {
+	for _, eventType := range []string{"DELETE", "delete", "http://www.ft.com/thing/ThingChangeType/DELETE"} {
+		stored, err := StoredEventTypes(eventType)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"DELETE", "http://www.ft.com/thing/ThingChangeType/DELETE"}, stored, "Unexpected stored types for %s", eventType)
+	}
+
+	_, err := StoredEventTypes("PUBLISH")
+	var unknown UnknownEventTypeError
+	assert.True(t, errors.As(err, &unknown))
+	assert.Equal(t, "PUBLISH", unknown.EventType)
+}
@@ -0,0 +1,62 @@
+package mapping
+
+import (
+	"github.com/Financial-Times/list-notifications-rw/model"
+)
+
+// DiffItems sets the items which were added, removed or reordered on the notification, compared to the previous notification for the same list.
+// A nil previous notification means this is the first notification for the list, so every item is treated as added.
+func DiffItems(previous *model.InternalNotification, notification *model.InternalNotification) {
+	var previousItems []model.ListItem
+	if previous != nil {
+		previousItems = previous.Items
+	}
+
+	previousIDs := itemIDs(previousItems)
+	currentIDs := itemIDs(notification.Items)
+
+	notification.AddedItems = difference(currentIDs, previousIDs)
+	notification.RemovedItems = difference(previousIDs, currentIDs)
+	notification.Reordered = isReordered(previousIDs, currentIDs)
+}
+
+func itemIDs(items []model.ListItem) []string {
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.UUID)
+	}
+	return ids
+}
+
+// difference returns the ids in a which are not in b, keeping the order of a.
+func difference(a []string, b []string) []string {
+	inB := make(map[string]bool, len(b))
+	for _, id := range b {
+		inB[id] = true
+	}
+
+	var diff []string
+	for _, id := range a {
+		if !inB[id] {
+			diff = append(diff, id)
+		}
+	}
+	return diff
+}
+
+// isReordered returns true if the items present in both lists are not in the same relative order.
+func isReordered(previous []string, current []string) bool {
+	common := difference(previous, difference(previous, current))
+	kept := difference(current, difference(current, previous))
+
+	if len(common) != len(kept) {
+		return true // duplicated items have changed, so treat the list as reordered
+	}
+
+	for i := range common {
+		if common[i] != kept[i] {
+			return true
+		}
+	}
+	return false
+}
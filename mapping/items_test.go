@@ -0,0 +1,59 @@
+package mapping
+
+import (
+	"testing"
+
+	"github.com/Financial-Times/list-notifications-rw/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func items(ids ...string) []model.ListItem {
+	result := make([]model.ListItem, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, model.ListItem{UUID: id})
+	}
+	return result
+}
+
+func TestDiffItemsFirstNotification(t *testing.T) {
+	notification := &model.InternalNotification{Items: items("a", "b")}
+
+	DiffItems(nil, notification)
+
+	assert.Equal(t, []string{"a", "b"}, notification.AddedItems)
+	assert.Empty(t, notification.RemovedItems)
+	assert.False(t, notification.Reordered)
+}
+
+func TestDiffItemsAddedAndRemoved(t *testing.T) {
+	previous := &model.InternalNotification{Items: items("a", "b", "c")}
+	notification := &model.InternalNotification{Items: items("d", "a", "c")}
+
+	DiffItems(previous, notification)
+
+	assert.Equal(t, []string{"d"}, notification.AddedItems)
+	assert.Equal(t, []string{"b"}, notification.RemovedItems)
+	assert.False(t, notification.Reordered, "a and c are still in the same relative order")
+}
+
+func TestDiffItemsReordered(t *testing.T) {
+	previous := &model.InternalNotification{Items: items("a", "b", "c")}
+	notification := &model.InternalNotification{Items: items("c", "b", "a")}
+
+	DiffItems(previous, notification)
+
+	assert.Empty(t, notification.AddedItems)
+	assert.Empty(t, notification.RemovedItems)
+	assert.True(t, notification.Reordered)
+}
+
+func TestDiffItemsUnchanged(t *testing.T) {
+	previous := &model.InternalNotification{Items: items("a", "b")}
+	notification := &model.InternalNotification{Items: items("a", "b")}
+
+	DiffItems(previous, notification)
+
+	assert.Empty(t, notification.AddedItems)
+	assert.Empty(t, notification.RemovedItems)
+	assert.False(t, notification.Reordered)
+}
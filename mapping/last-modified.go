@@ -0,0 +1,74 @@
+package mapping
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Financial-Times/list-notifications-rw/model"
+)
+
+// The policies for lastModified dates which are further in the future than the allowed skew.
+const (
+	RejectSkewPolicy = "reject"
+	ClampSkewPolicy  = "clamp"
+)
+
+// LastModifiedPolicy validates the lastModified date of incoming notifications against the server time.
+type LastModifiedPolicy struct {
+	MaxSkew     time.Duration // A zero MaxSkew disables the check.
+	Clamp       bool          // Clamp future dates to the server time, rather than rejecting them.
+	MaxBackdate time.Duration // How far in the past a date may be before it is clamped to the server time.
+}
+
+// NewLastModifiedPolicy creates a LastModifiedPolicy, where policy is one of RejectSkewPolicy or ClampSkewPolicy. Readers
+// cannot have read past notifications which were last modified within the cache delay, so it should be the max backdate.
+func NewLastModifiedPolicy(maxSkewSeconds int, policy string, maxBackdateSeconds int) (LastModifiedPolicy, error) {
+	if maxSkewSeconds < 0 {
+		return LastModifiedPolicy{}, fmt.Errorf("max skew must not be negative, got %d", maxSkewSeconds)
+	}
+
+	if maxBackdateSeconds < 0 {
+		return LastModifiedPolicy{}, fmt.Errorf("max backdate must not be negative, got %d", maxBackdateSeconds)
+	}
+
+	switch policy {
+	case RejectSkewPolicy, ClampSkewPolicy:
+	default:
+		return LastModifiedPolicy{}, fmt.Errorf("unknown skew policy %q, expected %s or %s", policy, RejectSkewPolicy, ClampSkewPolicy)
+	}
+
+	return LastModifiedPolicy{
+		MaxSkew:     time.Duration(maxSkewSeconds) * time.Second,
+		Clamp:       policy == ClampSkewPolicy,
+		MaxBackdate: time.Duration(maxBackdateSeconds) * time.Second,
+	}, nil
+}
+
+// apply records when the notification was received, and assigns or validates its lastModified date. A date further in
+// the past than the max backdate would be behind readers which have already paged past it, so they would never read
+// the notification; it is moved forward to the server time instead, and the original date is kept for ordering.
+func (p LastModifiedPolicy) apply(notification *model.InternalNotification, now time.Time) error {
+	notification.ReceivedAt = now
+
+	if notification.LastModified.IsZero() {
+		notification.LastModified = now
+		return nil
+	}
+
+	if notification.LastModified.Before(now.Add(-p.MaxBackdate)) {
+		notification.OriginalLastModified = notification.LastModified
+		notification.LastModified = now
+		return nil
+	}
+
+	if p.MaxSkew == 0 || !notification.LastModified.After(now.Add(p.MaxSkew)) {
+		return nil
+	}
+
+	if p.Clamp {
+		notification.LastModified = now
+		return nil
+	}
+
+	return fmt.Errorf("List lastModified %s is more than %s in the future!", notification.LastModified.Format(time.RFC3339Nano), p.MaxSkew)
+}
@@ -0,0 +1,100 @@
+package mapping
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/list-notifications-rw/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLastModifiedPolicy(t *testing.T) {
+	policy, err := NewLastModifiedPolicy(30, "clamp", 10)
+	require.NoError(t, err)
+	assert.Equal(t, LastModifiedPolicy{MaxSkew: 30 * time.Second, Clamp: true, MaxBackdate: 10 * time.Second}, policy)
+
+	policy, err = NewLastModifiedPolicy(0, "reject", 0)
+	require.NoError(t, err)
+	assert.Equal(t, LastModifiedPolicy{}, policy)
+
+	_, err = NewLastModifiedPolicy(30, "ignore", 10)
+	assert.Error(t, err)
+
+	_, err = NewLastModifiedPolicy(-1, "clamp", 10)
+	assert.Error(t, err)
+
+	_, err = NewLastModifiedPolicy(30, "clamp", -1)
+	assert.Error(t, err)
+}
+
+func TestLastModifiedPolicyAssignsMissingDate(t *testing.T) {
+	now := time.Now().UTC()
+	notification := &model.InternalNotification{}
+
+	err := LastModifiedPolicy{MaxSkew: time.Minute}.apply(notification, now)
+	require.NoError(t, err)
+	assert.Equal(t, now, notification.LastModified)
+	assert.Equal(t, now, notification.ReceivedAt)
+}
+
+func TestLastModifiedPolicyAllowsDateWithinSkew(t *testing.T) {
+	now := time.Now().UTC()
+	lastModified := now.Add(30 * time.Second)
+	notification := &model.InternalNotification{LastModified: lastModified}
+
+	err := LastModifiedPolicy{MaxSkew: time.Minute}.apply(notification, now)
+	require.NoError(t, err)
+	assert.Equal(t, lastModified, notification.LastModified)
+	assert.Equal(t, now, notification.ReceivedAt)
+}
+
+func TestLastModifiedPolicyAllowsDateWithinBackdate(t *testing.T) {
+	now := time.Now().UTC()
+	lastModified := now.Add(-5 * time.Second)
+	notification := &model.InternalNotification{LastModified: lastModified}
+
+	err := LastModifiedPolicy{MaxSkew: time.Minute, MaxBackdate: 10 * time.Second}.apply(notification, now)
+	require.NoError(t, err)
+	assert.Equal(t, lastModified, notification.LastModified)
+	assert.True(t, notification.OriginalLastModified.IsZero())
+}
+
+func TestLastModifiedPolicyMovesBackdatedDateForward(t *testing.T) {
+	now := time.Now().UTC()
+	lastModified := now.Add(-24 * time.Hour)
+	notification := &model.InternalNotification{LastModified: lastModified}
+
+	err := LastModifiedPolicy{MaxSkew: time.Minute, MaxBackdate: 10 * time.Second}.apply(notification, now)
+	require.NoError(t, err)
+	assert.Equal(t, now, notification.LastModified)
+	assert.Equal(t, lastModified, notification.OriginalLastModified)
+	assert.Equal(t, now, notification.ReceivedAt)
+}
+
+func TestLastModifiedPolicyClampsFutureDate(t *testing.T) {
+	now := time.Now().UTC()
+	notification := &model.InternalNotification{LastModified: now.Add(time.Hour)}
+
+	err := LastModifiedPolicy{MaxSkew: time.Minute, Clamp: true}.apply(notification, now)
+	require.NoError(t, err)
+	assert.Equal(t, now, notification.LastModified)
+}
+
+func TestLastModifiedPolicyRejectsFutureDate(t *testing.T) {
+	now := time.Now().UTC()
+	notification := &model.InternalNotification{LastModified: now.Add(time.Hour)}
+
+	err := LastModifiedPolicy{MaxSkew: time.Minute}.apply(notification, now)
+	assert.Error(t, err)
+}
+
+func TestLastModifiedPolicyDisabled(t *testing.T) {
+	now := time.Now().UTC()
+	lastModified := now.Add(time.Hour)
+	notification := &model.InternalNotification{LastModified: lastModified}
+
+	err := LastModifiedPolicy{}.apply(notification, now)
+	require.NoError(t, err)
+	assert.Equal(t, lastModified, notification.LastModified)
+}
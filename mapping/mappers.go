@@ -5,21 +5,29 @@ import (
 	"errors"
 	"net/url"
 	"regexp"
+	"time"
 
 	"github.com/Financial-Times/list-notifications-rw/model"
 )
 
 var isUUID = regexp.MustCompile("[a-z0-9]{8}-[a-z0-9]{4}-[a-z0-9]{4}-[a-z0-9]{4}-[a-z0-9]{12}")
 
+// IsUUID returns true if the given string is a valid list uuid
+func IsUUID(uuid string) bool {
+	return len(uuid) == 36 && isUUID.MatchString(uuid)
+}
+
 // NotificationsMapper maps notifications from json to internal and internal to public.
 type NotificationsMapper interface {
 	MapRequestToInternalNotification(uuid string, decoder *json.Decoder) (*model.InternalNotification, error)
-	MapInternalNotificationToPublic(notification model.InternalNotification) model.PublicNotification
+	MapDeleteRequestToInternalNotification(uuid string, transactionID string) (*model.InternalNotification, error)
+	MapInternalNotificationToPublic(notification model.InternalNotification) (model.PublicNotification, error)
 }
 
 // DefaultMapper is the standard NotificationsMapper implementation
 type DefaultMapper struct {
-	ApiHost string
+	ApiHost      string
+	LastModified LastModifiedPolicy
 }
 
 // MapRequestToInternalNotification maps json (from a decoder) to an InternalNotification
@@ -39,20 +47,49 @@ func (m DefaultMapper) MapRequestToInternalNotification(uuid string, decoder *js
 		return nil, errors.New("List contained a different UUID to the request URI!")
 	}
 
-	notification.EventType = "UPDATE"
+	if err = m.LastModified.apply(notification, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+
+	notification.EventType = UpdateEventType
 	return notification, nil
 }
 
-// MapInternalNotificationToPublic maps an InternalNotification to a PublicNotification
-func (m DefaultMapper) MapInternalNotificationToPublic(notification model.InternalNotification) model.PublicNotification {
+// MapDeleteRequestToInternalNotification creates a DELETE InternalNotification for the given list uuid and transaction ID
+func (m DefaultMapper) MapDeleteRequestToInternalNotification(uuid string, transactionID string) (*model.InternalNotification, error) {
+	if !isUUID.MatchString(uuid) {
+		return nil, errors.New("Request contained an invalid UUID!")
+	}
+
+	if transactionID == "" {
+		return nil, errors.New("Request has no transaction id!")
+	}
+
+	now := time.Now().UTC()
+	return &model.InternalNotification{
+		UUID:             uuid,
+		EventType:        DeleteEventType,
+		PublishReference: transactionID,
+		LastModified:     now,
+		ReceivedAt:       now,
+	}, nil
+}
+
+// MapInternalNotificationToPublic maps an InternalNotification to a PublicNotification, or errors if the stored eventType is unknown
+func (m DefaultMapper) MapInternalNotificationToPublic(notification model.InternalNotification) (model.PublicNotification, error) {
+	eventType, err := PublicEventType(notification.EventType)
+	if err != nil {
+		return model.PublicNotification{}, err
+	}
+
 	return model.PublicNotification{
 		ID:               m.buildId(notification.UUID),
 		APIURL:           m.buildApiUrl(notification.UUID),
-		Type:             "http://www.ft.com/thing/ThingChangeType/UPDATE",
+		Type:             eventType,
 		Title:            notification.Title,
 		PublishReference: notification.PublishReference,
 		LastModified:     notification.LastModified.UTC(),
-	}
+	}, nil
 }
 
 func (m DefaultMapper) buildId(uuid string) string {
@@ -10,24 +10,41 @@ import (
 )
 
 // NextLinkGenerator returns the link to the next result set in a paginated response.
+// If the request's time window is bounded by an until date, and the notifications are the last page of it, there is no next link.
+// The limit is the page size requested by the user; zero, or anything above the max limit, means the max limit.
 type NextLinkGenerator interface {
-	NextLink(since time.Time, offset int, notifications []model.InternalNotification) model.Link
+	NextLink(since time.Time, until time.Time, offset int, limit int, notifications []model.InternalNotification, params url.Values) (model.Link, bool)
 	ProcessRequestLink(uri *url.URL) *url.URL
+	WithPath(path string) NextLinkGenerator
 }
 
+// notificationsPath is the path of next links, unless the generator is given another
+const notificationsPath = "/lists/notifications"
+
 // OffsetNextLink is the default implementation for NextLinkGenerator
 type OffsetNextLink struct {
 	ApiHost    string
 	CacheDelay int
 	MaxLimit   int
+	Path       string // The path of the next links; empty means /lists/notifications.
 }
 
-// NextLink given the since date and offset from the original incoming request, and the notifications read from the db, return the 'next' link
-func (o OffsetNextLink) NextLink(since time.Time, offset int, notifications []model.InternalNotification) model.Link {
+// NextLink given the since date, until date and offset from the original incoming request, and the notifications read from the db, return the 'next' link.
+// Any additional params from the original request which must be carried forward are added to the link.
+func (o OffsetNextLink) NextLink(since time.Time, until time.Time, offset int, limit int, notifications []model.InternalNotification, params url.Values) (model.Link, bool) {
+	o.MaxLimit = PageLimit(limit, o.MaxLimit) // the page boundary depends on the size of the requested page
+
+	if isLastPage(until, o.CacheDelay, o.MaxLimit, notifications) {
+		return model.Link{}, false
+	}
+
 	updatedSince := o.calculateSince(notifications, since)
+	if reachesUntil(updatedSince, until) {
+		return model.Link{}, false
+	}
 	updatedOffset := o.calculateOffset(notifications, offset)
 
-	return o.generateLink(updatedSince, updatedOffset)
+	return o.generateLink(updatedSince, updatedOffset, withUntil(params, until)), true
 }
 
 func (o OffsetNextLink) ProcessRequestLink(uri *url.URL) *url.URL {
@@ -36,13 +53,25 @@ func (o OffsetNextLink) ProcessRequestLink(uri *url.URL) *url.URL {
 	return uri
 }
 
-func (o OffsetNextLink) generateLink(since time.Time, offset int) model.Link {
+// WithPath returns a copy of the generator whose next links are to the given path
+func (o OffsetNextLink) WithPath(path string) NextLinkGenerator {
+	o.Path = path
+	return o
+}
+
+func (o OffsetNextLink) generateLink(since time.Time, offset int, carried url.Values) model.Link {
 	uri := url.URL{}
 	uri.Scheme = "http"
 	uri.Host = o.ApiHost
-	uri.Path = "/lists/notifications"
+	uri.Path = linkPath(o.Path)
 	params := uri.Query()
 
+	for key, values := range carried {
+		for _, value := range values {
+			params.Add(key, value)
+		}
+	}
+
 	if offset > 0 {
 		params.Add("offset", strconv.Itoa(offset))
 	}
@@ -91,6 +120,51 @@ func (o OffsetNextLink) calculateOffset(notifications []model.InternalNotificati
 	return size - 1 // otherwise, return new offset minus one for the extra boundary record
 }
 
+// isLastPage returns true if the notifications are the last page of a window bounded by until; that is, there are no more
+// notifications in the window to read, and the window has closed so no more can be read into it.
+func isLastPage(until time.Time, cacheDelay int, maxLimit int, notifications []model.InternalNotification) bool {
+	if until.IsZero() || len(notifications) > maxLimit {
+		return false
+	}
+
+	till := time.Now().UTC().Add(time.Duration(-1*cacheDelay) * time.Second)
+	return !until.After(till)
+}
+
+// reachesUntil returns true if the next page would start at or after the until date, so there is nothing left to read
+// in the window; the next request would be rejected, as its since date must be before the until date.
+func reachesUntil(since time.Time, until time.Time) bool {
+	return !until.IsZero() && !since.Before(until)
+}
+
+// withUntil returns a copy of the params which includes the until date, if there is one
+func withUntil(params url.Values, until time.Time) url.Values {
+	carried := url.Values{}
+	for key, values := range params {
+		carried[key] = values
+	}
+
+	if !until.IsZero() {
+		carried.Set("until", until.Format(time.RFC3339Nano))
+	}
+	return carried
+}
+
+func linkPath(path string) string {
+	if path == "" {
+		return notificationsPath
+	}
+	return path
+}
+
+// PageLimit returns the size of a page given the limit requested by the user, which is capped at the max limit
+func PageLimit(limit int, maxLimit int) int {
+	if limit <= 0 || limit > maxLimit {
+		return maxLimit
+	}
+	return limit
+}
+
 func min(a, b int) int {
 	if a < b {
 		return a
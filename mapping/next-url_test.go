@@ -2,6 +2,7 @@ package mapping
 
 import (
 	"net/url"
+	"strconv"
 	"testing"
 	"time"
 
@@ -32,9 +33,10 @@ func TestNextLink(t *testing.T) {
 	calculated := nextLink.calculateSince(notifications, since)
 	offset := nextLink.calculateOffset(notifications, 10)
 
-	link := nextLink.NextLink(since, 10, notifications)
+	link, ok := nextLink.NextLink(since, time.Time{}, 10, 0, notifications, nil)
+	assert.True(t, ok, "There should always be a next link without an until date")
 	assert.Equal(t, "next", link.Rel, "Should be hardcoded to next.")
-	assert.Equal(t, nextLink.generateLink(calculated, offset).Href, link.Href, "Should match generated link.")
+	assert.Equal(t, nextLink.generateLink(calculated, offset, nil).Href, link.Href, "Should match generated link.")
 }
 
 func TestRequestURL(t *testing.T) {
@@ -48,7 +50,7 @@ func TestRequestURL(t *testing.T) {
 func TestGenerateLinkWithOffset(t *testing.T) {
 	now := time.Now().UTC()
 
-	link := nextLink.generateLink(now, 10)
+	link := nextLink.generateLink(now, 10, nil)
 	uri, _ := url.Parse("http://go-tests.ft.com/lists/notifications?since=" + now.Format(time.RFC3339Nano) + "&offset=10")
 	uri.RawQuery = uri.Query().Encode()
 
@@ -58,13 +60,23 @@ func TestGenerateLinkWithOffset(t *testing.T) {
 func TestGenerateLinkWithoutOffset(t *testing.T) {
 	now := time.Now().UTC()
 
-	link := nextLink.generateLink(now, 0)
+	link := nextLink.generateLink(now, 0, nil)
 	uri, _ := url.Parse("http://go-tests.ft.com/lists/notifications?since=" + now.Format(time.RFC3339Nano))
 	uri.RawQuery = uri.Query().Encode()
 
 	assert.Equal(t, uri.String(), link.Href, "This is the link we should generate")
 }
 
+func TestGenerateLinkWithCarriedParams(t *testing.T) {
+	now := time.Now().UTC()
+
+	link := nextLink.generateLink(now, 0, url.Values{"itemChanges": []string{"true"}})
+	uri, _ := url.Parse("http://go-tests.ft.com/lists/notifications?since=" + now.Format(time.RFC3339Nano) + "&itemChanges=true")
+	uri.RawQuery = uri.Query().Encode()
+
+	assert.Equal(t, uri.String(), link.Href, "This is the link we should generate")
+}
+
 func TestBoundaryHasSameDate(t *testing.T) {
 	now := time.Now()
 
@@ -199,3 +211,134 @@ func TestCalculateSincePartialPage(t *testing.T) {
 	since := nextLink.calculateSince(notifications, now.Add(-20*time.Second))
 	assert.Equal(t, now.Add(-1*time.Second).Add(5*time.Second), since, "Should return last in set + cache delay.")
 }
+
+func TestNextLinkWithUntil(t *testing.T) {
+	generator := OffsetNextLink{ApiHost: "go-tests.ft.com", MaxLimit: 2, CacheDelay: 10}
+	now := time.Now().UTC()
+	until := now.Add(-time.Hour)
+
+	notifications := []model.InternalNotification{
+		{LastModified: until.Add(-2 * time.Minute)},
+		{LastModified: until.Add(-time.Minute)},
+	}
+
+	_, ok := generator.NextLink(until.Add(-time.Hour), until, 0, 0, notifications, nil)
+	assert.False(t, ok, "The last page of a closed window should have no next link")
+
+	link, ok := generator.NextLink(until.Add(-time.Hour), until, 0, 0, append(notifications, model.InternalNotification{LastModified: until.Add(-time.Second)}), nil)
+	assert.True(t, ok, "There are more notifications in the window")
+	uri, _ := url.Parse(link.Href)
+	assert.Equal(t, until.Format(time.RFC3339Nano), uri.Query().Get("until"), "The until date should be carried forward")
+
+	_, ok = generator.NextLink(now.Add(-time.Minute), now.Add(time.Minute), 0, 0, notifications, nil)
+	assert.True(t, ok, "Notifications may still be written into a window which has not closed")
+}
+
+func TestNextLinkStopsAtUntil(t *testing.T) {
+	generator := OffsetNextLink{ApiHost: "go-tests.ft.com", MaxLimit: 2, CacheDelay: 10}
+	until := time.Now().UTC().Add(time.Hour)
+
+	notifications := []model.InternalNotification{
+		{LastModified: until.Add(-time.Minute)},
+		{LastModified: until.Add(-5 * time.Second)},
+		{LastModified: until.Add(-5 * time.Second)},
+	}
+
+	_, ok := generator.NextLink(until.Add(-time.Hour), until, 0, 0, notifications, nil)
+	assert.False(t, ok, "A next link whose since date is not before the until date could not be followed")
+}
+
+func TestNextLinkWithLimit(t *testing.T) {
+	generator := OffsetNextLink{ApiHost: "go-tests.ft.com", MaxLimit: 200, CacheDelay: 10}
+	now := time.Now().UTC()
+	since := now.Add(-time.Hour)
+
+	notifications := []model.InternalNotification{ // a page of 2, plus the look-ahead notification
+		{LastModified: now.Add(-3 * time.Second)},
+		{LastModified: now.Add(-2 * time.Second)},
+		{LastModified: now.Add(-2 * time.Second)},
+	}
+
+	link, ok := generator.NextLink(since, time.Time{}, 0, 2, notifications, url.Values{"limit": []string{"2"}})
+	assert.True(t, ok)
+
+	uri, _ := url.Parse(link.Href)
+	assert.Equal(t, now.Add(-2*time.Second).Add(10*time.Second).Format(time.RFC3339Nano), uri.Query().Get("since"), "The since date should be the last notification on the page of 2")
+	assert.Equal(t, "1", uri.Query().Get("offset"), "The boundary should be calculated for the page of 2")
+	assert.Equal(t, "2", uri.Query().Get("limit"))
+}
+
+func TestPageLimit(t *testing.T) {
+	assert.Equal(t, 200, PageLimit(0, 200))
+	assert.Equal(t, 200, PageLimit(-1, 200))
+	assert.Equal(t, 20, PageLimit(20, 200))
+	assert.Equal(t, 200, PageLimit(1000, 200))
+}
+
+func TestNextLinkWithPath(t *testing.T) {
+	since := time.Now().UTC().Add(-time.Minute)
+
+	link, ok := nextLink.WithPath("/lists/ef863741-709a-4062-a8f1-987c44db1db5/notifications").NextLink(since, time.Time{}, 0, 0, nil, nil)
+	assert.True(t, ok)
+
+	uri, err := url.Parse(link.Href)
+	assert.NoError(t, err)
+	assert.Equal(t, "/lists/ef863741-709a-4062-a8f1-987c44db1db5/notifications", uri.Path)
+	assert.Equal(t, since.Format(time.RFC3339Nano), uri.Query().Get("since"))
+}
+
+func TestNextLinkPagesThroughRepeatedUUIDs(t *testing.T) {
+	start := time.Date(2017, 02, 02, 12, 51, 0, 0, time.UTC)
+	t1, t2, t3 := start.Add(time.Second), start.Add(2*time.Second), start.Add(3*time.Second)
+
+	// uncollapsed notifications, in the order the db returns them, where the same list appears several times on a page
+	stored := []model.InternalNotification{
+		{UUID: "a", PublishReference: "tid_1", LastModified: t1},
+		{UUID: "a", PublishReference: "tid_2", LastModified: t2},
+		{UUID: "a", PublishReference: "tid_3", LastModified: t2},
+		{UUID: "b", PublishReference: "tid_4", LastModified: t2},
+		{UUID: "a", PublishReference: "tid_5", LastModified: t3},
+		{UUID: "a", PublishReference: "tid_6", LastModified: t3},
+	}
+
+	// read mimics the db query for the since and offset parameters
+	read := func(since time.Time, offset int, limit int) []model.InternalNotification {
+		shifted := since.Add(-10 * time.Second)
+		var page []model.InternalNotification
+		for _, n := range stored {
+			if n.LastModified.After(shifted) || (offset > 0 && n.LastModified.Equal(shifted)) {
+				page = append(page, n)
+			}
+		}
+		page = page[min(offset, len(page)):]
+		return page[:min(limit+1, len(page))]
+	}
+
+	links := OffsetNextLink{ApiHost: "go-tests.ft.com", MaxLimit: 200, CacheDelay: 10}
+	since, offset := start.Add(10*time.Second), 0
+
+	var seen []string
+	for i := 0; i < 10; i++ {
+		page := read(since, offset, 2)
+		if len(page) == 0 {
+			break
+		}
+		for _, n := range page[:min(2, len(page))] {
+			seen = append(seen, n.PublishReference)
+		}
+
+		link, _ := links.NextLink(since, time.Time{}, offset, 2, page, nil)
+		uri, err := url.Parse(link.Href)
+		assert.NoError(t, err)
+
+		since, err = time.Parse(time.RFC3339Nano, uri.Query().Get("since"))
+		assert.NoError(t, err)
+		offset = 0
+		if param := uri.Query().Get("offset"); param != "" {
+			offset, err = strconv.Atoi(param)
+			assert.NoError(t, err)
+		}
+	}
+
+	assert.Equal(t, []string{"tid_1", "tid_2", "tid_3", "tid_4", "tid_5", "tid_6"}, seen, "Every notification should be read exactly once")
+}
@@ -0,0 +1,30 @@
+package mapping
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Financial-Times/list-notifications-rw/model"
+)
+
+// AdvancePosition moves the position past the notification, exactly as the next link of a page ending with it would.
+func AdvancePosition(position model.Position, notification model.InternalNotification, cacheDelay time.Duration) model.Position {
+	since := notification.LastModified.Add(cacheDelay)
+	if position.Offset > 0 && since.Equal(position.Since) {
+		position.Offset++
+		return position
+	}
+
+	return model.Position{Since: since, Offset: 1}
+}
+
+// PositionParams returns the since and offset query parameters which read the notifications after the position.
+func PositionParams(position model.Position) url.Values {
+	params := url.Values{}
+	params.Set("since", position.Since.UTC().Format(time.RFC3339Nano))
+	if position.Offset > 0 {
+		params.Set("offset", strconv.Itoa(position.Offset))
+	}
+	return params
+}
@@ -0,0 +1,25 @@
+package mapping
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/list-notifications-rw/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdvancePosition(t *testing.T) {
+	since, _ := time.Parse(time.RFC3339Nano, "2006-01-02T15:04:05Z")
+	position := model.Position{Since: since}
+	assert.Equal(t, "since=2006-01-02T15%3A04%3A05Z", PositionParams(position).Encode())
+
+	lastModified := since.Add(time.Minute)
+	position = AdvancePosition(position, model.InternalNotification{LastModified: lastModified}, 10*time.Second)
+	assert.Equal(t, "offset=1&since=2006-01-02T15%3A05%3A15Z", PositionParams(position).Encode(), "The since date should include the cache delay, like the next link")
+
+	position = AdvancePosition(position, model.InternalNotification{LastModified: lastModified}, 10*time.Second)
+	assert.Equal(t, "offset=2&since=2006-01-02T15%3A05%3A15Z", PositionParams(position).Encode(), "Notifications with the same lastModified date should increase the offset")
+
+	position = AdvancePosition(position, model.InternalNotification{LastModified: lastModified.Add(time.Second)}, 10*time.Second)
+	assert.Equal(t, "offset=1&since=2006-01-02T15%3A05%3A16Z", PositionParams(position).Encode())
+}
@@ -0,0 +1,43 @@
+package mapping
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// UUIDsParam is the query parameter which carries, in next links, the list uuids which were POSTed in a request body
+const UUIDsParam = "uuids"
+
+var errInvalidUUIDs = errors.New("invalid uuids token")
+
+// EncodeUUIDs packs the list uuids into one compact, url safe token of 16 bytes per uuid, so that filters which are
+// too long to carry as uuid parameters can still be carried forward in next links.
+func EncodeUUIDs(uuids []string) (string, error) {
+	packed := make([]byte, 0, 16*len(uuids))
+	for _, uuid := range uuids {
+		raw, err := hex.DecodeString(strings.ReplaceAll(uuid, "-", ""))
+		if err != nil || len(raw) != 16 {
+			return "", fmt.Errorf("uuid %q cannot be encoded", uuid)
+		}
+		packed = append(packed, raw...)
+	}
+	return base64.RawURLEncoding.EncodeToString(packed), nil
+}
+
+// DecodeUUIDs unpacks the list uuids from a token generated by EncodeUUIDs
+func DecodeUUIDs(token string) ([]string, error) {
+	packed, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(packed)%16 != 0 {
+		return nil, errInvalidUUIDs
+	}
+
+	uuids := make([]string, 0, len(packed)/16)
+	for i := 0; i < len(packed); i += 16 {
+		h := hex.EncodeToString(packed[i : i+16])
+		uuids = append(uuids, h[:8]+"-"+h[8:12]+"-"+h[12:16]+"-"+h[16:20]+"-"+h[20:])
+	}
+	return uuids, nil
+}
@@ -0,0 +1,32 @@
+package mapping
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUUIDsRoundTrip(t *testing.T) {
+	uuids := []string{"ef863741-709a-4062-a8f1-987c44db1db5", "2f0ea3a0-cd1d-4a3d-8a5a-02f1a7c1b1d9"}
+
+	token, err := EncodeUUIDs(uuids)
+	require.NoError(t, err)
+	assert.Len(t, token, 43, "Two uuids should pack into 32 bytes")
+
+	decoded, err := DecodeUUIDs(token)
+	require.NoError(t, err)
+	assert.Equal(t, uuids, decoded)
+}
+
+func TestEncodeUUIDsRejectsNonHexUUIDs(t *testing.T) {
+	_, err := EncodeUUIDs([]string{"zzzzzzzz-709a-4062-a8f1-987c44db1db5"})
+	assert.Error(t, err)
+}
+
+func TestDecodeUUIDsRejectsInvalidTokens(t *testing.T) {
+	for _, token := range []string{"not base64!", "c2hvcnQ"} {
+		_, err := DecodeUUIDs(token)
+		assert.Error(t, err, token)
+	}
+}
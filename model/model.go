@@ -4,13 +4,34 @@ import (
 	"time"
 )
 
+// ListItem represents a single item within a list
+type ListItem struct {
+	UUID string `json:"uuid" bson:"uuid"`
+}
+
+// Concept represents the concept a list is associated with
+type Concept struct {
+	UUID      string `json:"uuid" bson:"uuid"`
+	PrefLabel string `json:"prefLabel,omitempty" bson:"prefLabel,omitempty"`
+}
+
 // InternalNotification represents the document format within database
 type InternalNotification struct {
-	Title            string    `json:"title" bson:"title"`
-	UUID             string    `json:"uuid" bson:"uuid"`
-	EventType        string    `json:"eventType" bson:"eventType"`
-	PublishReference string    `json:"publishReference" bson:"publishReference"`
-	LastModified     time.Time `json:"lastModified,omitempty" bson:"lastModified,omitempty"`
+	Title                string     `json:"title" bson:"title"`
+	UUID                 string     `json:"uuid" bson:"uuid"`
+	EventType            string     `json:"eventType" bson:"eventType"`
+	PublishReference     string     `json:"publishReference" bson:"publishReference"`
+	LastModified         time.Time  `json:"lastModified,omitempty" bson:"lastModified,omitempty"`
+	OriginalLastModified time.Time  `json:"-" bson:"originalLastModified,omitempty"`
+	ReceivedAt           time.Time  `json:"-" bson:"receivedAt,omitempty"`
+	LayoutHint           string     `json:"layoutHint,omitempty" bson:"layoutHint,omitempty"`
+	ListType             string     `json:"listType,omitempty" bson:"listType,omitempty"`
+	Concept              *Concept   `json:"concept,omitempty" bson:"concept,omitempty"`
+	Items                []ListItem `json:"items,omitempty" bson:"items,omitempty"`
+	AddedItems           []string   `json:"-" bson:"addedItems,omitempty"`
+	RemovedItems         []string   `json:"-" bson:"removedItems,omitempty"`
+	Reordered            bool       `json:"-" bson:"reordered,omitempty"`
+	Superseded           bool       `json:"-" bson:"superseded,omitempty"`
 }
 
 // PublicNotification represents the public format for a notification (seen on read)
@@ -21,6 +42,12 @@ type PublicNotification struct {
 	Title            string    `json:"title"`
 	PublishReference string    `json:"publishReference,omitempty"`
 	LastModified     time.Time `json:"lastModified,omitempty"`
+	LayoutHint       string    `json:"layoutHint,omitempty"`
+	ListType         string    `json:"listType,omitempty"`
+	Concept          *Concept  `json:"concept,omitempty"`
+	AddedItems       []string  `json:"addedItems,omitempty"`
+	RemovedItems     []string  `json:"removedItems,omitempty"`
+	Reordered        *bool     `json:"reordered,omitempty"`
 }
 
 // Link represents the next url in the notification page
@@ -34,4 +61,85 @@ type PublicNotificationPage struct {
 	RequestURL    string               `json:"requestUrl"`
 	Notifications []PublicNotification `json:"notifications"`
 	Links         []Link               `json:"links"`
+	LastPage      bool                 `json:"lastPage,omitempty"`
+	Truncated     *Truncation          `json:"truncated,omitempty"`
+}
+
+// Truncation describes a since date which was older than the max since interval, and so was clamped to the oldest permitted date
+type Truncation struct {
+	RequestedSince time.Time `json:"requestedSince"`
+	Since          time.Time `json:"since"`
+	Missed         int64     `json:"missed"` // The number of stored notifications between the requested since date and the clamped one.
+}
+
+// BatchWriteResult represents the outcome of writing a single list in a batch
+type BatchWriteResult struct {
+	Index            int    `json:"index"`
+	UUID             string `json:"uuid,omitempty"`
+	PublishReference string `json:"publishReference,omitempty"`
+	Status           string `json:"status"`
+	Reason           string `json:"reason,omitempty"`
+}
+
+// BatchWriteReport represents the per-item outcome of a batch write
+type BatchWriteReport struct {
+	Results []BatchWriteResult `json:"results"`
+}
+
+// OutboxMessage represents a notification waiting to be published to downstream consumers
+type OutboxMessage struct {
+	ID            string               `bson:"_id"`
+	Notification  InternalNotification `bson:"notification"`
+	CreatedAt     time.Time            `bson:"createdAt"`
+	Attempts      int                  `bson:"attempts"`
+	NextAttemptAt time.Time            `bson:"nextAttemptAt,omitempty"`
+	LastError     string               `bson:"lastError,omitempty"`
+	PublishedAt   time.Time            `bson:"publishedAt,omitempty"`
+}
+
+// NotificationFilter restricts which notifications are read; empty fields match every notification
+type NotificationFilter struct {
+	UUIDs      []string
+	EventTypes []string
+	Until      time.Time // only notifications last modified before this date; the zero value means up to now
+	// Uncollapsed reads every notification, rather than collapsing the notifications for each list into the latest one
+	Uncollapsed bool
+}
+
+// Position is a position in the notifications, in terms of the since date and offset parameters of the read endpoint
+type Position struct {
+	Since  time.Time `json:"since" bson:"since"`
+	Offset int       `json:"offset" bson:"offset"`
+}
+
+// Subscription represents a callback url which is sent every notification matching its filters
+type Subscription struct {
+	ID          string               `json:"id" bson:"_id"`
+	CallbackURL string               `json:"callbackUrl" bson:"callbackUrl"`
+	Secret      string               `json:"secret,omitempty" bson:"secret"`
+	UUIDs       []string             `json:"uuids,omitempty" bson:"uuids,omitempty"`
+	Types       []string             `json:"types,omitempty" bson:"types,omitempty"`
+	CreatedAt   time.Time            `json:"createdAt" bson:"createdAt"`
+	Delivery    SubscriptionDelivery `json:"delivery" bson:"delivery"`
+}
+
+// SubscriptionDelivery represents the progress of delivering notifications to a subscription
+type SubscriptionDelivery struct {
+	Position      Position  `json:"position" bson:"position"`
+	Attempts      int       `json:"attempts" bson:"attempts"`
+	NextAttemptAt time.Time `json:"nextAttemptAt,omitempty" bson:"nextAttemptAt,omitempty"`
+	LastError     string    `json:"lastError,omitempty" bson:"lastError,omitempty"`
+	Delivered     int       `json:"delivered" bson:"delivered"`
+	Failed        int       `json:"failed" bson:"failed"`
+	DeadLettered  int       `json:"deadLettered" bson:"deadLettered"`
+}
+
+// DeadLetter represents a notification which could not be delivered to a subscription
+type DeadLetter struct {
+	ID             string               `json:"id" bson:"_id"`
+	SubscriptionID string               `json:"subscriptionId" bson:"subscriptionId"`
+	Notification   InternalNotification `json:"notification" bson:"notification"`
+	Attempts       int                  `json:"attempts" bson:"attempts"`
+	LastError      string               `json:"lastError" bson:"lastError"`
+	CreatedAt      time.Time            `json:"createdAt" bson:"createdAt"`
 }
@@ -0,0 +1,199 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/list-notifications-rw/mapping"
+	"github.com/Financial-Times/list-notifications-rw/model"
+	"github.com/rcrowley/go-metrics"
+)
+
+// publishTimeout is how long the publisher may take to publish each message
+const publishTimeout = 10 * time.Second
+
+var (
+	published = metrics.GetOrRegisterCounter("list_notifications_outbox_published", metrics.DefaultRegistry)
+	failed    = metrics.GetOrRegisterCounter("list_notifications_outbox_failed", metrics.DefaultRegistry)
+)
+
+type store interface {
+	ReadOutbox(limit int, now time.Time) ([]model.OutboxMessage, error)
+	MarkOutboxPublished(id string) error
+	MarkOutboxFailed(id string, attempts int, nextAttemptAt time.Time, reason string) error
+	AcquireOutboxLease(owner string, ttl time.Duration) (bool, error)
+}
+
+// Config configures how often the Dispatcher polls the outbox, and how it retries failed messages.
+type Config struct {
+	Owner        string        // Identifies this instance when taking the publishing lease.
+	PollInterval time.Duration // How long to wait between polls of the outbox.
+	BatchSize    int           // The max number of messages read per poll.
+	MinBackoff   time.Duration // The delay before the first retry, doubled for each subsequent attempt.
+	MaxBackoff   time.Duration // The max delay between retries.
+}
+
+// Dispatcher publishes messages from the outbox in the background. Messages for the same list are published in the order
+// they were written; if one fails, later messages for that list wait until it has been retried successfully.
+type Dispatcher struct {
+	config    Config
+	store     store
+	publisher Publisher
+	mapper    mapping.NotificationsMapper
+	log       *logger.UPPLogger
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// NewDispatcher creates a Dispatcher; call Start to begin publishing.
+func NewDispatcher(config Config, store store, publisher Publisher, mapper mapping.NotificationsMapper, log *logger.UPPLogger) *Dispatcher {
+	return &Dispatcher{
+		config:    config,
+		store:     store,
+		publisher: publisher,
+		mapper:    mapper,
+		log:       log,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Start begins publishing in a background goroutine.
+func (d *Dispatcher) Start() {
+	go d.run()
+}
+
+// Stop waits for the current poll to finish, then stops publishing.
+func (d *Dispatcher) Stop() {
+	close(d.stop)
+	<-d.done
+}
+
+func (d *Dispatcher) run() {
+	defer close(d.done)
+
+	ticker := time.NewTicker(d.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+			d.poll()
+		}
+	}
+}
+
+func (d *Dispatcher) poll() {
+	if !d.lease() {
+		return // another instance is publishing
+	}
+
+	d.dispatch(time.Now().UTC())
+}
+
+// lease takes or renews the publishing lease, which lasts long enough to publish one more message. It is renewed before
+// each message, so that another instance cannot take it over, and publish the same messages, while a batch is published.
+func (d *Dispatcher) lease() bool {
+	leased, err := d.store.AcquireOutboxLease(d.config.Owner, 3*d.config.PollInterval+publishTimeout)
+	if err != nil {
+		d.log.WithError(err).Error("Failed to acquire the outbox lease")
+		return false
+	}
+	return leased
+}
+
+// dispatch publishes every due message in the next batch from the outbox, keeping messages for each list in order.
+func (d *Dispatcher) dispatch(now time.Time) {
+	messages, err := d.store.ReadOutbox(d.config.BatchSize, now)
+	if err != nil {
+		d.log.WithError(err).Error("Failed to read the outbox")
+		return
+	}
+
+	blocked := make(map[string]bool)
+	for _, message := range messages {
+		uuid := message.Notification.UUID
+		if blocked[uuid] {
+			continue
+		}
+
+		if message.NextAttemptAt.After(now) {
+			blocked[uuid] = true // an earlier attempt failed, so later messages for this list must wait for it
+			continue
+		}
+
+		if !d.lease() {
+			d.log.Warn("Lost the outbox lease, another instance will publish the rest of the outbox.")
+			return
+		}
+
+		if !d.publish(message, now) {
+			blocked[uuid] = true
+		}
+	}
+}
+
+func (d *Dispatcher) publish(message model.OutboxMessage, now time.Time) bool {
+	logEntry := d.log.WithField("uuid", message.Notification.UUID).WithField("transaction_id", message.Notification.PublishReference)
+
+	body, err := d.body(message)
+	if err != nil { // this message can never be published, so don't let it block the list
+		logEntry.WithError(err).Error("Dropping outbox message which cannot be mapped to the public format.")
+		d.markPublished(message, logEntry)
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	err = d.publisher.Publish(ctx, Message{
+		Key:           message.Notification.UUID,
+		TransactionID: message.Notification.PublishReference,
+		Body:          body,
+	})
+	if err != nil {
+		failed.Inc(1)
+		attempts := message.Attempts + 1
+		logEntry.WithError(err).WithField("attempts", attempts).Warn("Failed to publish outbox message, it will be retried.")
+		if err = d.store.MarkOutboxFailed(message.ID, attempts, now.Add(d.backoff(attempts)), err.Error()); err != nil {
+			logEntry.WithError(err).Error("Failed to record failed attempt to publish outbox message")
+		}
+		return false
+	}
+
+	published.Inc(1)
+	return d.markPublished(message, logEntry)
+}
+
+func (d *Dispatcher) markPublished(message model.OutboxMessage, logEntry *logger.LogEntry) bool {
+	if err := d.store.MarkOutboxPublished(message.ID); err != nil {
+		logEntry.WithError(err).Error("Failed to mark outbox message as published, it may be published again.")
+		return false
+	}
+	return true
+}
+
+func (d *Dispatcher) body(message model.OutboxMessage) ([]byte, error) {
+	public, err := d.mapper.MapInternalNotificationToPublic(message.Notification)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(public)
+}
+
+// backoff returns the exponential delay before the given attempt is retried.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	backoff := d.config.MinBackoff
+	for i := 1; i < attempts && backoff < d.config.MaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > d.config.MaxBackoff {
+		return d.config.MaxBackoff
+	}
+	return backoff
+}
@@ -0,0 +1,165 @@
+package outbox
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/list-notifications-rw/mapping"
+	"github.com/Financial-Times/list-notifications-rw/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var testConfig = Config{
+	Owner:        "test",
+	PollInterval: time.Second,
+	BatchSize:    10,
+	MinBackoff:   time.Second,
+	MaxBackoff:   time.Minute,
+}
+
+var testMapper = mapping.DefaultMapper{ApiHost: "testing-123.com"}
+
+func outboxMessage(uuid, tid string) model.OutboxMessage {
+	return model.OutboxMessage{
+		ID: uuid + "/" + tid,
+		Notification: model.InternalNotification{
+			UUID:             uuid,
+			EventType:        "UPDATE",
+			PublishReference: tid,
+		},
+	}
+}
+
+func TestDispatchPublishesInOrder(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	now := time.Now().UTC()
+
+	store := new(MockStore)
+	store.On("AcquireOutboxLease", "test", 13*time.Second).Return(true, nil).Maybe()
+	store.On("ReadOutbox", 10, now).Return([]model.OutboxMessage{outboxMessage("uuid1", "tid_1"), outboxMessage("uuid2", "tid_2")}, nil)
+	store.On("MarkOutboxPublished", "uuid1/tid_1").Return(nil)
+	store.On("MarkOutboxPublished", "uuid2/tid_2").Return(nil)
+
+	publisher := new(MockPublisher)
+	first := publisher.On("Publish", "uuid1", "tid_1").Return(nil)
+	publisher.On("Publish", "uuid2", "tid_2").Return(nil).NotBefore(first)
+
+	NewDispatcher(testConfig, store, publisher, testMapper, log).dispatch(now)
+
+	store.AssertExpectations(t)
+	publisher.AssertExpectations(t)
+}
+
+func TestDispatchFailureBlocksLaterMessagesForTheSameList(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	now := time.Now().UTC()
+
+	store := new(MockStore)
+	store.On("AcquireOutboxLease", "test", 13*time.Second).Return(true, nil).Maybe()
+	store.On("ReadOutbox", 10, now).Return([]model.OutboxMessage{
+		outboxMessage("uuid1", "tid_1"),
+		outboxMessage("uuid2", "tid_2"),
+		outboxMessage("uuid1", "tid_3"),
+	}, nil)
+	store.On("MarkOutboxFailed", "uuid1/tid_1", 1, now.Add(time.Second), "kafka is down").Return(nil)
+	store.On("MarkOutboxPublished", "uuid2/tid_2").Return(nil)
+
+	publisher := new(MockPublisher)
+	publisher.On("Publish", "uuid1", "tid_1").Return(errors.New("kafka is down"))
+	publisher.On("Publish", "uuid2", "tid_2").Return(nil)
+
+	NewDispatcher(testConfig, store, publisher, testMapper, log).dispatch(now)
+
+	store.AssertExpectations(t)
+	publisher.AssertExpectations(t)
+	publisher.AssertNotCalled(t, "Publish", "uuid1", "tid_3")
+}
+
+func TestDispatchWaitsForBackoff(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	now := time.Now().UTC()
+
+	waiting := outboxMessage("uuid1", "tid_1")
+	waiting.Attempts = 2
+	waiting.NextAttemptAt = now.Add(time.Minute)
+
+	store := new(MockStore)
+	store.On("AcquireOutboxLease", "test", 13*time.Second).Return(true, nil).Maybe()
+	store.On("ReadOutbox", 10, now).Return([]model.OutboxMessage{waiting, outboxMessage("uuid1", "tid_2")}, nil)
+
+	publisher := new(MockPublisher)
+
+	NewDispatcher(testConfig, store, publisher, testMapper, log).dispatch(now)
+
+	store.AssertExpectations(t)
+	publisher.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything)
+}
+
+func TestDispatchDropsUnmappableMessages(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	now := time.Now().UTC()
+
+	unknown := outboxMessage("uuid1", "tid_1")
+	unknown.Notification.EventType = "PUBLISH"
+
+	store := new(MockStore)
+	store.On("AcquireOutboxLease", "test", 13*time.Second).Return(true, nil).Maybe()
+	store.On("ReadOutbox", 10, now).Return([]model.OutboxMessage{unknown, outboxMessage("uuid1", "tid_2")}, nil)
+	store.On("MarkOutboxPublished", "uuid1/tid_1").Return(nil)
+	store.On("MarkOutboxPublished", "uuid1/tid_2").Return(nil)
+
+	publisher := new(MockPublisher)
+	publisher.On("Publish", "uuid1", "tid_2").Return(nil)
+
+	NewDispatcher(testConfig, store, publisher, testMapper, log).dispatch(now)
+
+	store.AssertExpectations(t)
+	publisher.AssertExpectations(t)
+}
+
+func TestDispatchStopsWhenLeaseIsLost(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	now := time.Now().UTC()
+
+	store := new(MockStore)
+	store.On("ReadOutbox", 10, now).Return([]model.OutboxMessage{outboxMessage("uuid1", "tid_1"), outboxMessage("uuid2", "tid_2")}, nil)
+	store.On("AcquireOutboxLease", "test", 13*time.Second).Return(true, nil).Once()
+	store.On("AcquireOutboxLease", "test", 13*time.Second).Return(false, nil).Once()
+	store.On("MarkOutboxPublished", "uuid1/tid_1").Return(nil)
+
+	publisher := new(MockPublisher)
+	publisher.On("Publish", "uuid1", "tid_1").Return(nil)
+
+	NewDispatcher(testConfig, store, publisher, testMapper, log).dispatch(now)
+
+	store.AssertExpectations(t)
+	publisher.AssertExpectations(t)
+	publisher.AssertNotCalled(t, "Publish", "uuid2", "tid_2")
+}
+
+func TestPollWithoutLease(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+
+	store := new(MockStore)
+	store.On("AcquireOutboxLease", "test", 13*time.Second).Return(false, nil)
+
+	publisher := new(MockPublisher)
+
+	NewDispatcher(testConfig, store, publisher, testMapper, log).poll()
+
+	store.AssertExpectations(t)
+	store.AssertNotCalled(t, "ReadOutbox", mock.Anything, mock.Anything)
+}
+
+func TestBackoff(t *testing.T) {
+	d := NewDispatcher(testConfig, nil, nil, testMapper, nil)
+
+	assert.Equal(t, time.Second, d.backoff(1))
+	assert.Equal(t, 2*time.Second, d.backoff(2))
+	assert.Equal(t, 32*time.Second, d.backoff(6))
+	assert.Equal(t, time.Minute, d.backoff(7))
+	assert.Equal(t, time.Minute, d.backoff(100))
+}
@@ -0,0 +1,55 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// FilePublisher writes each message as a line of json, for testing locally.
+type FilePublisher struct {
+	mu     sync.Mutex
+	out    io.Writer
+	closer io.Closer
+}
+
+type fileMessage struct {
+	Key           string          `json:"key"`
+	TransactionID string          `json:"transactionId"`
+	Body          json.RawMessage `json:"body"`
+}
+
+// NewFilePublisher creates a FilePublisher which appends to the file at path, or writes to stdout if path is empty or "-".
+func NewFilePublisher(path string) (*FilePublisher, error) {
+	if path == "" || path == "-" {
+		return &FilePublisher{out: os.Stdout}, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FilePublisher{out: f, closer: f}, nil
+}
+
+// Publish writes the message as a single line of json.
+func (p *FilePublisher) Publish(ctx context.Context, message Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return json.NewEncoder(p.out).Encode(fileMessage{
+		Key:           message.Key,
+		TransactionID: message.TransactionID,
+		Body:          message.Body,
+	})
+}
+
+// Close closes the file, if one was opened.
+func (p *FilePublisher) Close() error {
+	if p.closer == nil {
+		return nil
+	}
+	return p.closer.Close()
+}
@@ -0,0 +1,33 @@
+package outbox
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilePublisher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.ndjson")
+
+	publisher, err := NewFilePublisher(path)
+	require.NoError(t, err)
+
+	require.NoError(t, publisher.Publish(context.Background(), Message{Key: "uuid1", TransactionID: "tid_1", Body: []byte(`{"id":"1"}`)}))
+	require.NoError(t, publisher.Publish(context.Background(), Message{Key: "uuid2", TransactionID: "tid_2", Body: []byte(`{"id":"2"}`)}))
+	require.NoError(t, publisher.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, `{"key":"uuid1","transactionId":"tid_1","body":{"id":"1"}}`+"\n"+`{"key":"uuid2","transactionId":"tid_2","body":{"id":"2"}}`+"\n", string(data))
+}
+
+func TestFilePublisherStdout(t *testing.T) {
+	publisher, err := NewFilePublisher("-")
+	require.NoError(t, err)
+	assert.Equal(t, os.Stdout, publisher.out)
+	assert.NoError(t, publisher.Close(), "Should not close stdout")
+}
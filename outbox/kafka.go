@@ -0,0 +1,43 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaPublisher publishes messages to a Kafka topic, keyed by list uuid so each list's messages stay on one partition, in order.
+type KafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+// NewKafkaPublisher creates a KafkaPublisher for the given brokers and topic.
+func NewKafkaPublisher(brokers []string, topic string) *KafkaPublisher {
+	return &KafkaPublisher{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			MaxAttempts:  1, // the dispatcher handles retries, so it can keep messages in order
+			BatchTimeout: 10 * time.Millisecond,
+		},
+	}
+}
+
+// Publish writes the message to the topic, and waits for it to be acknowledged.
+func (p *KafkaPublisher) Publish(ctx context.Context, message Message) error {
+	return p.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(message.Key),
+		Value: message.Body,
+		Headers: []kafka.Header{
+			{Key: "X-Request-Id", Value: []byte(message.TransactionID)},
+		},
+	})
+}
+
+// Close flushes and closes the underlying writer.
+func (p *KafkaPublisher) Close() error {
+	return p.writer.Close()
+}
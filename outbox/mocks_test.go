@@ -0,0 +1,51 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/Financial-Times/list-notifications-rw/model"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockStore struct {
+	mock.Mock
+}
+
+func (m *MockStore) ReadOutbox(limit int, now time.Time) ([]model.OutboxMessage, error) {
+	args := m.Called(limit, now)
+	messages := args.Get(0)
+	if messages == nil {
+		return nil, args.Error(1)
+	}
+	return messages.([]model.OutboxMessage), args.Error(1)
+}
+
+func (m *MockStore) MarkOutboxPublished(id string) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockStore) MarkOutboxFailed(id string, attempts int, nextAttemptAt time.Time, reason string) error {
+	args := m.Called(id, attempts, nextAttemptAt, reason)
+	return args.Error(0)
+}
+
+func (m *MockStore) AcquireOutboxLease(owner string, ttl time.Duration) (bool, error) {
+	args := m.Called(owner, ttl)
+	return args.Bool(0), args.Error(1)
+}
+
+type MockPublisher struct {
+	mock.Mock
+}
+
+func (m *MockPublisher) Publish(ctx context.Context, message Message) error {
+	args := m.Called(message.Key, message.TransactionID)
+	return args.Error(0)
+}
+
+func (m *MockPublisher) Close() error {
+	args := m.Called()
+	return args.Error(0)
+}
@@ -0,0 +1,18 @@
+package outbox
+
+import (
+	"context"
+)
+
+// Message is a notification ready to be published downstream. Messages with the same Key must be delivered in order.
+type Message struct {
+	Key           string
+	TransactionID string
+	Body          []byte
+}
+
+// Publisher publishes outbox messages to downstream consumers.
+type Publisher interface {
+	Publish(ctx context.Context, message Message) error
+	Close() error
+}
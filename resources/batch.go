@@ -0,0 +1,276 @@
+package resources
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/list-notifications-rw/mapping"
+	"github.com/Financial-Times/list-notifications-rw/model"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	batchWritten    = "written"
+	batchSkipped    = "skipped"
+	batchInvalid    = "invalid"
+	batchDuplicate  = "duplicate"
+	batchStale      = "stale"
+	batchSuperseded = "superseded"
+	batchFailed     = "failed"
+)
+
+const maxBatchLineSize = 1024 * 1024
+
+// maxBatchSize is the most lists which may be written in one batch
+const maxBatchSize = 1000
+
+var errBatchTooLarge = fmt.Errorf("batch contains more than %d lists", maxBatchSize)
+
+type batchWriter interface {
+	notificationFinder
+	latestNotificationFinder
+	WriteNotifications(notifications []*model.InternalNotification) error
+}
+
+// BatchWriteNotifications will write notifications for many lists at once. The body is either a json array of lists, or
+// newline delimited json with one list per line. The response reports the outcome for each list in the order received.
+func BatchWriteNotifications(dumpRequests bool, mapper mapping.NotificationsMapper, writer batchWriter, log *logger.UPPLogger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if dumpRequests {
+			dumpRequest(r, log)
+		}
+
+		logEntry := log.WithField("transaction_id", r.Header.Get(tidHeader))
+
+		items, err := readBatch(r.Body)
+		if errors.Is(err, errBatchTooLarge) {
+			logEntry.WithError(err).Info("Batch request is too large!")
+			if err = writeMessage(fmt.Sprintf("Please send at most %d lists per batch.", maxBatchSize), 413, w); err != nil {
+				logEntry.WithError(err).Error("Failed to write message for unsuccessful batch read")
+			}
+			return
+		}
+		if err != nil {
+			logEntry.WithError(err).Error("Invalid batch request! See error for details.")
+			if err = writeMessage("Invalid Request body.", 400, w); err != nil {
+				logEntry.WithError(err).Error("Failed to write message for unsuccessful batch read")
+			}
+			return
+		}
+
+		results := make([]model.BatchWriteResult, len(items))
+		toWrite := make([]*model.InternalNotification, 0, len(items))
+		positions := make([]int, 0, len(items))
+
+		for i, item := range items {
+			notification, result := mapBatchItem(i, item, mapper, writer, logEntry)
+			results[i] = result
+			if notification != nil {
+				toWrite = append(toWrite, notification)
+				positions = append(positions, i)
+			}
+		}
+
+		toWrite, positions = orderBatchItems(toWrite, positions, results, writer, logEntry)
+
+		if len(toWrite) > 0 {
+			err = writer.WriteNotifications(toWrite)
+
+			var bulkErr mongo.BulkWriteException
+			switch {
+			case err == nil:
+			case errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil:
+				for _, writeErr := range bulkErr.WriteErrors {
+					result := &results[positions[writeErr.Index]]
+					if mongo.IsDuplicateKeyError(writeErr.WriteError) {
+						result.Status = batchDuplicate
+						result.Reason = "Notification has already been recorded."
+						continue
+					}
+					result.Status = batchFailed
+					result.Reason = writeErr.Message
+				}
+			default:
+				logEntry.WithError(err).Error("Failed to write batch of notifications")
+				if err = writeMessage("Failed to write notifications.", 500, w); err != nil {
+					logEntry.WithError(err).Error("Failed to write message for unsuccessful batch write")
+				}
+				return
+			}
+		}
+
+		logEntry.WithField("size", len(items)).Info("Successfully processed a batch of list notifications.")
+
+		w.Header().Add("Content-Type", "application/json")
+		if err = json.NewEncoder(w).Encode(model.BatchWriteReport{Results: results}); err != nil {
+			logEntry.WithError(err).Error("Failed to encode batch report")
+		}
+	}
+}
+
+// mapBatchItem validates a single list from the batch, and returns the notification to write (if any) and its initial result.
+func mapBatchItem(index int, item json.RawMessage, mapper mapping.NotificationsMapper, finder notificationFinder, log *logger.LogEntry) (*model.InternalNotification, model.BatchWriteResult) {
+	result := model.BatchWriteResult{Index: index}
+
+	list := struct {
+		UUID string `json:"uuid"`
+	}{}
+	if err := json.Unmarshal(item, &list); err != nil {
+		result.Status = batchInvalid
+		result.Reason = err.Error()
+		return nil, result
+	}
+	result.UUID = list.UUID
+
+	notification, err := mapper.MapRequestToInternalNotification(list.UUID, json.NewDecoder(bytes.NewReader(item)))
+	if err != nil {
+		result.Status = batchInvalid
+		result.Reason = err.Error()
+		return nil, result
+	}
+
+	tid := notification.PublishReference
+	result.PublishReference = tid
+	logEntry := log.WithField("uuid", notification.UUID).WithField("batch_transaction_id", tid)
+
+	if tid == "" {
+		result.Status = batchInvalid
+		result.Reason = "List has no publishReference."
+		return nil, result
+	}
+
+	if strings.HasPrefix(strings.ToUpper(tid), synthTidPrefix) {
+		result.Status = batchSkipped
+		result.Reason = "List has a synthetic transaction id."
+		return nil, result
+	}
+
+	if generatedCarouselTidRegex.MatchString(tid) {
+		result.Status = batchSkipped
+		result.Reason = "Skipping generated carousel publish."
+		return nil, result
+	}
+
+	if !shouldWriteNotification(tid, finder, logEntry) {
+		result.Status = batchSkipped
+		result.Reason = "Skipping carousel publish; the original notification was published successfully."
+		return nil, result
+	}
+
+	result.Status = batchWritten
+	return notification, result
+}
+
+// orderBatchItems records the item changes for each notification in the batch, and removes the notifications which are
+// older than an earlier notification for the same list in the batch. Notifications older than the latest notification
+// already recorded for their list (e.g. when backfilling after an incident) are still written, but flagged as superseded,
+// so that they are kept in the list's history without replacing its latest notification.
+func orderBatchItems(notifications []*model.InternalNotification, positions []int, results []model.BatchWriteResult, finder latestNotificationFinder, log *logger.LogEntry) ([]*model.InternalNotification, []int) {
+	ordered := make([]*model.InternalNotification, 0, len(notifications))
+	orderedPositions := make([]int, 0, len(positions))
+
+	recorded := make(map[string]*model.InternalNotification) // the latest recorded notification for each list
+	found := make(map[string]bool)                           // whether it was looked up successfully
+	previous := make(map[string]*model.InternalNotification) // the previous notification for each list in the batch
+	for i, notification := range notifications {
+		result := &results[positions[i]]
+		if isOlder(notification, previous[notification.UUID]) {
+			staleWrites.Inc(1)
+			result.Status = batchStale
+			result.Reason = "A newer notification for this list is earlier in the batch."
+			continue
+		}
+
+		if _, ok := found[notification.UUID]; !ok {
+			recorded[notification.UUID], found[notification.UUID] = findPrevious(notification, finder, log.WithField("uuid", notification.UUID))
+		}
+
+		latest := recorded[notification.UUID]
+		if isOlder(notification, latest) {
+			notification.Superseded = true
+			result.Status = batchSuperseded
+			result.Reason = "A newer notification has already been recorded for this list, so this one was only added to its history."
+		} else if p := previous[notification.UUID]; p != nil && !p.Superseded {
+			mapping.DiffItems(p, notification)
+		} else if found[notification.UUID] {
+			mapping.DiffItems(latest, notification)
+		}
+
+		previous[notification.UUID] = notification
+		ordered = append(ordered, notification)
+		orderedPositions = append(orderedPositions, positions[i])
+	}
+
+	return ordered, orderedPositions
+}
+
+// readBatch splits the body into individual lists, accepting either a json array or newline delimited json. Reading stops
+// with errBatchTooLarge as soon as the batch has more than maxBatchSize lists.
+func readBatch(body io.Reader) ([]json.RawMessage, error) {
+	reader := bufio.NewReader(body)
+
+	first, err := peekNonSpace(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]json.RawMessage, 0)
+	if first == '[' {
+		decoder := json.NewDecoder(reader)
+		if _, err = decoder.Token(); err != nil {
+			return nil, err
+		}
+		for decoder.More() {
+			if len(items) == maxBatchSize {
+				return nil, errBatchTooLarge
+			}
+			var item json.RawMessage
+			if err = decoder.Decode(&item); err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		_, err = decoder.Token()
+		return items, err
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxBatchLineSize)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if len(items) == maxBatchSize {
+			return nil, errBatchTooLarge
+		}
+		items = append(items, append(json.RawMessage{}, line...))
+	}
+
+	return items, scanner.Err()
+}
+
+func peekNonSpace(reader *bufio.Reader) (byte, error) {
+	for {
+		b, err := reader.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			if _, err = reader.ReadByte(); err != nil {
+				return 0, err
+			}
+		default:
+			return b[0], nil
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package resources
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/list-notifications-rw/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const batchList1 = `{"uuid":"ef863741-709a-4062-a8f1-987c44db1db5","title":"Unlocking Yield Top Stories","publishReference":"tid_batch1","lastModified":"2016-10-20T17:08:37.668Z"}`
+const batchList2 = `{"uuid":"a2f9e77a-62cb-11e5-9846-de406ccb37f2","title":"Technology","publishReference":"tid_batch2","lastModified":"2016-05-24T17:31:57.398Z"}`
+
+func decodeBatchReport(t *testing.T, w *httptest.ResponseRecorder) model.BatchWriteReport {
+	report := model.BatchWriteReport{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+	return report
+}
+
+func TestBatchWriteJSONArray(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("POST", "http://our.host.name/lists/notifications/batch", strings.NewReader("["+batchList1+","+batchList2+"]"))
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockClient.On("FindLatestNotification", mock.Anything).Return(nil, mongo.ErrNoDocuments)
+	mockClient.On("WriteNotifications", mock.MatchedBy(func(n []*model.InternalNotification) bool {
+		return len(n) == 2 && n[0].PublishReference == "tid_batch1" && n[1].PublishReference == "tid_batch2"
+	})).Return(nil)
+
+	BatchWriteNotifications(false, testMapper, mockClient, log)(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	report := decodeBatchReport(t, w)
+	require.Len(t, report.Results, 2)
+	assert.Equal(t, model.BatchWriteResult{Index: 0, UUID: "ef863741-709a-4062-a8f1-987c44db1db5", PublishReference: "tid_batch1", Status: "written"}, report.Results[0])
+	assert.Equal(t, model.BatchWriteResult{Index: 1, UUID: "a2f9e77a-62cb-11e5-9846-de406ccb37f2", PublishReference: "tid_batch2", Status: "written"}, report.Results[1])
+	mockClient.AssertExpectations(t)
+}
+
+func TestBatchWriteNDJSONWithInvalidAndCarouselItems(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	carousel := `{"uuid":"a2f9e77a-62cb-11e5-9846-de406ccb37f2","title":"Technology","publishReference":"tid_batch2_carousel_1234567890_gentx","lastModified":"2016-05-24T17:31:57.398Z"}`
+	body := batchList1 + "\n\n" + `{"uuid":"i am a bit invalid"}` + "\n" + carousel + "\n" + "not json\n"
+	req, _ := http.NewRequest("POST", "http://our.host.name/lists/notifications/batch", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockClient.On("FindLatestNotification", mock.Anything).Return(nil, mongo.ErrNoDocuments)
+	mockClient.On("WriteNotifications", mock.MatchedBy(func(n []*model.InternalNotification) bool {
+		return len(n) == 1 && n[0].PublishReference == "tid_batch1"
+	})).Return(nil)
+
+	BatchWriteNotifications(false, testMapper, mockClient, log)(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	report := decodeBatchReport(t, w)
+	require.Len(t, report.Results, 4)
+	assert.Equal(t, "written", report.Results[0].Status)
+	assert.Equal(t, "invalid", report.Results[1].Status)
+	assert.Equal(t, "List contained an invalid UUID!", report.Results[1].Reason)
+	assert.Equal(t, "skipped", report.Results[2].Status)
+	assert.Equal(t, "invalid", report.Results[3].Status)
+	mockClient.AssertExpectations(t)
+}
+
+func TestBatchWriteReportsDuplicates(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("POST", "http://our.host.name/lists/notifications/batch", strings.NewReader("["+batchList1+","+batchList2+"]"))
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	bulkErr := mongo.BulkWriteException{
+		WriteErrors: []mongo.BulkWriteError{
+			{WriteError: mongo.WriteError{Index: 1, Code: 11000, Message: "E11000 duplicate key error"}},
+		},
+	}
+	mockClient.On("FindLatestNotification", mock.Anything).Return(nil, mongo.ErrNoDocuments)
+	mockClient.On("WriteNotifications", mock.Anything).Return(bulkErr)
+
+	BatchWriteNotifications(false, testMapper, mockClient, log)(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	report := decodeBatchReport(t, w)
+	require.Len(t, report.Results, 2)
+	assert.Equal(t, "written", report.Results[0].Status)
+	assert.Equal(t, "duplicate", report.Results[1].Status)
+	mockClient.AssertExpectations(t)
+}
+
+func TestBatchWriteFailed(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("POST", "http://our.host.name/lists/notifications/batch", strings.NewReader(batchList1))
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockClient.On("FindLatestNotification", mock.Anything).Return(nil, mongo.ErrNoDocuments)
+	mockClient.On("WriteNotifications", mock.Anything).Return(errors.New("i broke"))
+
+	BatchWriteNotifications(false, testMapper, mockClient, log)(w, req)
+
+	assert.Equal(t, 500, w.Code)
+	mockClient.AssertExpectations(t)
+}
+
+func TestBatchWriteEmptyBody(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("POST", "http://our.host.name/lists/notifications/batch", strings.NewReader(" \n"))
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+
+	BatchWriteNotifications(false, testMapper, mockClient, log)(w, req)
+
+	assert.Equal(t, 400, w.Code)
+	mockClient.AssertNotCalled(t, "WriteNotifications", mock.Anything)
+}
+
+func TestBatchWriteMalformedArray(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("POST", "http://our.host.name/lists/notifications/batch", strings.NewReader("["+batchList1+","))
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+
+	BatchWriteNotifications(false, testMapper, mockClient, log)(w, req)
+
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestBatchWriteTooLarge(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	lists := make([]string, maxBatchSize+1)
+	for i := range lists {
+		lists[i] = batchList1
+	}
+
+	for name, body := range map[string]string{
+		"json array": "[" + strings.Join(lists, ",") + "]",
+		"ndjson":     strings.Join(lists, "\n"),
+	} {
+		req, _ := http.NewRequest("POST", "http://our.host.name/lists/notifications/batch", strings.NewReader(body))
+		w := httptest.NewRecorder()
+
+		mockClient := new(MockClient)
+
+		BatchWriteNotifications(false, testMapper, mockClient, log)(w, req)
+
+		assert.Equal(t, 413, w.Code, name)
+		mockClient.AssertNotCalled(t, "WriteNotifications", mock.Anything)
+	}
+}
+
+func TestBatchWriteReportsStaleAndSupersededItems(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	older := `{"uuid":"ef863741-709a-4062-a8f1-987c44db1db5","title":"Unlocking Yield Top Stories","publishReference":"tid_batch0","lastModified":"2016-10-20T17:00:00.000Z"}`
+	req, _ := http.NewRequest("POST", "http://our.host.name/lists/notifications/batch", strings.NewReader(batchList1+"\n"+older+"\n"+batchList2))
+	w := httptest.NewRecorder()
+
+	newer, _ := time.Parse(time.RFC3339Nano, "2016-06-01T00:00:00Z")
+	mockClient := new(MockClient)
+	mockClient.On("FindLatestNotification", "ef863741-709a-4062-a8f1-987c44db1db5").Return(nil, mongo.ErrNoDocuments)
+	mockClient.On("FindLatestNotification", "a2f9e77a-62cb-11e5-9846-de406ccb37f2").Return(model.InternalNotification{LastModified: newer}, nil)
+	mockClient.On("WriteNotifications", mock.MatchedBy(func(n []*model.InternalNotification) bool {
+		return len(n) == 2 &&
+			n[0].PublishReference == "tid_batch1" && !n[0].Superseded &&
+			n[1].PublishReference == "tid_batch2" && n[1].Superseded
+	})).Return(nil)
+
+	BatchWriteNotifications(false, testMapper, mockClient, log)(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	report := decodeBatchReport(t, w)
+	require.Len(t, report.Results, 3)
+	assert.Equal(t, "written", report.Results[0].Status)
+	assert.Equal(t, "stale", report.Results[1].Status, "Older than the earlier item in the batch")
+	assert.Equal(t, "superseded", report.Results[2].Status, "Older than the stored notification, so backfilled into the list's history")
+	mockClient.AssertExpectations(t)
+}
@@ -0,0 +1,93 @@
+package resources
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/list-notifications-rw/model"
+)
+
+// historicalMaxAge is how long pages of a closed time window may be cached, as they can no longer change
+const historicalMaxAge = 24 * time.Hour
+
+// pageMaxAge returns how long a page may be cached. Pages can change until they are past the cache delay, unless they
+// are bounded by an until date which is already past it. Such a window is closed to new notifications, including backfills,
+// as lastModified dates further in the past than the cache delay are moved forward to the server time when written (see
+// mapping.LastModifiedPolicy, whose max backdate must not be longer than the cache delay).
+func pageMaxAge(cacheDelay int, until time.Time) time.Duration {
+	delay := time.Duration(cacheDelay) * time.Second
+	if !until.IsZero() && !until.After(time.Now().UTC().Add(-delay)) {
+		return historicalMaxAge
+	}
+	return delay
+}
+
+// writePage writes the page read from since as json, or as the feed format requested by the Accept header. GET requests
+// are given caching headers: an ETag of the page contents, and the Last-Modified date of its newest notification, so
+// that conditional requests for an unchanged page get a 304.
+func writePage(page model.PublicNotificationPage, since time.Time, maxAge time.Duration, w http.ResponseWriter, r *http.Request, log *logger.UPPLogger) {
+	contentType, body, err := renderPage(page, since, negotiateFormat(r.Header.Get("Accept")))
+	if err != nil {
+		log.WithError(err).Error("Failed to encode page")
+		writeMessage("Failed to encode page.", 500, w)
+		return
+	}
+
+	w.Header().Add("Content-Type", contentType)
+	w.Header().Add("Vary", "Accept")
+
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		hash := sha256.Sum256(body)
+		etag := `"` + hex.EncodeToString(hash[:]) + `"`
+		lastModified := newest(page.Notifications)
+
+		w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(maxAge.Seconds())))
+		w.Header().Set("ETag", etag)
+		if !lastModified.IsZero() {
+			w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+		}
+
+		if notModified(r, etag, lastModified) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	if _, err = w.Write(body); err != nil {
+		log.WithError(err).Error("Failed to write page")
+	}
+}
+
+// notModified returns true if the request's If-None-Match or, without one, If-Modified-Since header matches the page.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if param := r.Header.Get("If-Modified-Since"); param != "" && !lastModified.IsZero() {
+		since, err := http.ParseTime(param)
+		return err == nil && !lastModified.Truncate(time.Second).After(since)
+	}
+	return false
+}
+
+func newest(notifications []model.PublicNotification) time.Time {
+	var newest time.Time
+	for _, n := range notifications {
+		if n.LastModified.After(newest) {
+			newest = n.LastModified
+		}
+	}
+	return newest
+}
@@ -0,0 +1,116 @@
+package resources
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/list-notifications-rw/mapping"
+	"github.com/Financial-Times/list-notifications-rw/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func cachedRead(t *testing.T, target string, headers map[string]string) *httptest.ResponseRecorder {
+	log := logger.NewUPPLogger("test", "debug")
+	changeDate := time.Date(2006, 01, 02, 15, 10, 5, 500000000, time.UTC)
+
+	mockClient := new(MockClient)
+	mockClient.On("GetLimit").Return(200)
+	mockClient.On("ReadNotifications", 0, 0, mock.Anything, mock.Anything).Return(&[]model.InternalNotification{
+		{UUID: "uuid", Title: "title", LastModified: changeDate.Add(-time.Minute), EventType: "UPDATE", PublishReference: "tid_1"},
+		{UUID: "uuid2", Title: "title", LastModified: changeDate, EventType: "UPDATE", PublishReference: "tid_2"},
+	}, nil)
+
+	req, _ := http.NewRequest("GET", target, nil)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
+	return w
+}
+
+func TestReadNotificationsCachingHeaders(t *testing.T) {
+	w := cachedRead(t, "http://nothing/at/all?since=2006-01-02T15:04:05Z", nil)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "max-age=10", w.Header().Get("Cache-Control"), "Pages should be cached for the cache delay")
+	assert.Regexp(t, `^"[0-9a-f]{64}"$`, w.Header().Get("ETag"))
+	assert.Equal(t, "Mon, 02 Jan 2006 15:10:05 GMT", w.Header().Get("Last-Modified"), "Last-Modified should be the newest notification's")
+
+	again := cachedRead(t, "http://nothing/at/all?since=2006-01-02T15:04:05Z", nil)
+	assert.Equal(t, w.Header().Get("ETag"), again.Header().Get("ETag"), "The same page should have the same ETag")
+
+	other := cachedRead(t, "http://nothing/at/all?since=2006-01-02T15:04:06Z", nil)
+	assert.NotEqual(t, w.Header().Get("ETag"), other.Header().Get("ETag"))
+}
+
+func TestReadNotificationsHistoricalPagesAreCachedForLonger(t *testing.T) {
+	w := cachedRead(t, "http://nothing/at/all?since=2006-01-02T15:04:05Z&until=2006-01-02T16:04:05Z", nil)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "max-age=86400", w.Header().Get("Cache-Control"))
+}
+
+func TestBackdatedWritesDoNotLandInCachedWindows(t *testing.T) {
+	policy, err := mapping.NewLastModifiedPolicy(60, mapping.ClampSkewPolicy, 10)
+	assert.NoError(t, err)
+	mapper := mapping.DefaultMapper{ApiHost: "testing-123.com", LastModified: policy}
+
+	until := time.Now().UTC().Add(-11 * time.Second)
+	assert.Equal(t, historicalMaxAge, pageMaxAge(10, until))
+
+	for _, backdate := range []time.Duration{time.Hour, 11 * time.Second, 10 * time.Second, time.Second} {
+		body := `{"uuid":"ef863741-709a-4062-a8f1-987c44db1db5","publishReference":"tid_backfill","lastModified":"` + time.Now().UTC().Add(-backdate).Format(time.RFC3339Nano) + `"}`
+		notification, err := mapper.MapRequestToInternalNotification("ef863741-709a-4062-a8f1-987c44db1db5", json.NewDecoder(strings.NewReader(body)))
+		assert.NoError(t, err)
+		assert.True(t, notification.LastModified.After(until), "A notification backdated by %s should not be written into a window cached for longer", backdate)
+	}
+}
+
+func TestReadNotificationsIfNoneMatch(t *testing.T) {
+	etag := cachedRead(t, "http://nothing/at/all?since=2006-01-02T15:04:05Z", nil).Header().Get("ETag")
+
+	w := cachedRead(t, "http://nothing/at/all?since=2006-01-02T15:04:05Z", map[string]string{"If-None-Match": `"other", W/` + etag})
+	assert.Equal(t, 304, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+
+	w = cachedRead(t, "http://nothing/at/all?since=2006-01-02T15:04:05Z", map[string]string{
+		"If-None-Match":     `"other"`,
+		"If-Modified-Since": "Mon, 02 Jan 2006 15:10:05 GMT",
+	})
+	assert.Equal(t, 200, w.Code, "If-Modified-Since should be ignored when If-None-Match is given")
+}
+
+func TestReadNotificationsIfModifiedSince(t *testing.T) {
+	w := cachedRead(t, "http://nothing/at/all?since=2006-01-02T15:04:05Z", map[string]string{"If-Modified-Since": "Mon, 02 Jan 2006 15:10:05 GMT"})
+	assert.Equal(t, 304, w.Code)
+
+	w = cachedRead(t, "http://nothing/at/all?since=2006-01-02T15:04:05Z", map[string]string{"If-Modified-Since": "Mon, 02 Jan 2006 15:10:04 GMT"})
+	assert.Equal(t, 200, w.Code)
+	assert.True(t, strings.HasPrefix(w.Body.String(), "{"))
+}
+
+func TestReadNotificationsPostIsNotCached(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+
+	mockClient := new(MockClient)
+	mockClient.On("GetLimit").Return(200)
+	mockClient.On("ReadNotifications", 0, 0, mock.Anything, mock.Anything).Return(&[]model.InternalNotification{}, nil)
+
+	req, _ := http.NewRequest("POST", "http://nothing/at/all?since=2006-01-02T15:04:05Z", strings.NewReader(`{"uuids":[]}`))
+	w := httptest.NewRecorder()
+
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Empty(t, w.Header().Get("ETag"))
+	assert.Empty(t, w.Header().Get("Cache-Control"))
+}
@@ -0,0 +1,220 @@
+package resources
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/list-notifications-rw/mapping"
+	"github.com/Financial-Times/list-notifications-rw/model"
+)
+
+// exportWriteTimeout is how long a client may take to receive each exported notification before it is disconnected
+const exportWriteTimeout = 30 * time.Second
+
+var csvHeader = []string{"id", "apiUrl", "type", "title", "publishReference", "lastModified"}
+
+type notificationExporter interface {
+	ExportNotifications(ctx context.Context, since time.Time, filter model.NotificationFilter, export func(notification model.InternalNotification) error) error
+}
+
+// ExportNotifications streams every notification last modified between the since and until dates, oldest first, as
+// newline delimited json or csv. As with ReadNotifications, the notifications for each list are collapsed into the
+// latest one unless collapse=false. The response is gzipped for clients which accept it. Exports are not limited by
+// the server's write timeout; instead, clients are disconnected if they are too slow to receive each notification.
+func ExportNotifications(mapper mapping.NotificationsMapper, exporter notificationExporter, log *logger.UPPLogger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		since, err := time.Parse(time.RFC3339Nano, r.URL.Query().Get("since"))
+		if err != nil {
+			log.WithError(err).Info("Failed to parse user provided since date.")
+			writeMessage("Please specify an RFC3339 since date.", 400, w)
+			return
+		}
+
+		until, err := getUntil(r)
+		if err != nil || until.IsZero() {
+			log.WithError(err).Info("Failed to parse user provided until date.")
+			writeMessage("Please specify an RFC3339 until date.", 400, w)
+			return
+		}
+		if !until.After(since) {
+			log.Infof("User provided until date which is not after the since date, until= [%v].", until.Format(time.RFC3339Nano))
+			writeMessage("Until date must be after the since date.", 400, w)
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = "ndjson"
+		}
+		if format != "ndjson" && format != "csv" {
+			log.WithField("format", format).Info("User provided an unknown export format.")
+			writeMessage("Please specify an export format of ndjson or csv.", 400, w)
+			return
+		}
+
+		collapse, err := getCollapse(r)
+		if err != nil {
+			log.WithError(err).Info("User provided collapse is not a boolean!")
+			writeMessage("Please specify a boolean collapse.", 400, w)
+			return
+		}
+
+		uuids, err := getUUIDs(r)
+		if err != nil {
+			log.WithError(err).Info("User provided invalid uuids!")
+			writeMessage(fmt.Sprintf("Please specify up to %d valid list uuids.", maxUUIDFilters), 400, w)
+			return
+		}
+
+		eventTypes, err := getEventTypes(r)
+		if err != nil {
+			log.WithError(err).Info("User provided an unknown event type!")
+			writeMessage("Please specify a known event type (CREATE, UPDATE, DELETE).", 400, w)
+			return
+		}
+
+		filter := model.NotificationFilter{UUIDs: uuids, EventTypes: eventTypes, Until: until, Uncollapsed: !collapse}
+		logEntry := log.WithField("since", since.Format(time.RFC3339Nano)).WithField("until", until.Format(time.RFC3339Nano))
+
+		export := &exportStream{
+			w:          w,
+			controller: http.NewResponseController(w),
+			format:     format,
+			gzip:       acceptsGzip(r),
+			filename:   fmt.Sprintf("list-notifications-%s-%s.%s", since.UTC().Format("20060102T150405Z"), until.UTC().Format("20060102T150405Z"), format),
+		}
+
+		err = exporter.ExportNotifications(r.Context(), since, filter, func(n model.InternalNotification) error {
+			public, err := mapper.MapInternalNotificationToPublic(n)
+			if err != nil {
+				logEntry.WithError(err).WithField("uuid", n.UUID).WithField("transaction_id", n.PublishReference).Warn("Skipping notification which cannot be mapped to the public format.")
+				return nil
+			}
+			return export.write(public)
+		})
+		if err == nil {
+			err = export.close()
+		}
+
+		switch {
+		case err == nil:
+			logEntry.WithField("count", export.count).Info("Exported notifications.")
+		case !export.started:
+			logEntry.WithError(err).Error("Failed to query database for notifications to export!")
+			writeMessage("Failed to export list notifications due to internal server error", 500, w)
+		default:
+			// the status has already been sent, so abort the response for the client to see it is incomplete
+			logEntry.WithError(err).WithField("count", export.count).Error("Failed to export notifications, the export is incomplete.")
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
+
+// exportStream writes the exported notifications in the requested format. The response is only started once there is
+// something to write, so that failing to query the db can still be reported with an error status.
+type exportStream struct {
+	w          http.ResponseWriter
+	controller *http.ResponseController
+	format     string
+	gzip       bool
+	filename   string
+
+	started bool
+	count   int
+	gz      *gzip.Writer
+	json    *json.Encoder
+	csv     *csv.Writer
+}
+
+func (s *exportStream) start() error {
+	s.started = true
+
+	if s.format == "csv" {
+		s.w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		s.w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	s.w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", s.filename))
+	s.w.Header().Set("Vary", "Accept-Encoding")
+
+	var out io.Writer = s.w
+	if s.gzip {
+		s.w.Header().Set("Content-Encoding", "gzip")
+		s.gz = gzip.NewWriter(s.w)
+		out = s.gz
+	}
+	s.w.WriteHeader(200)
+
+	if s.format == "csv" {
+		s.csv = csv.NewWriter(out)
+		return s.csv.Write(csvHeader)
+	}
+	s.json = json.NewEncoder(out)
+	return nil
+}
+
+func (s *exportStream) write(notification model.PublicNotification) error {
+	if !s.started {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+
+	err := s.controller.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+
+	s.count++
+	if s.csv != nil {
+		return s.csv.Write([]string{
+			notification.ID,
+			notification.APIURL,
+			notification.Type,
+			notification.Title,
+			notification.PublishReference,
+			notification.LastModified.UTC().Format(time.RFC3339Nano),
+		})
+	}
+	return s.json.Encode(notification)
+}
+
+// close finishes the export, which may be empty
+func (s *exportStream) close() error {
+	if !s.started {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+
+	if s.csv != nil {
+		s.csv.Flush()
+		if err := s.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if s.gz != nil {
+		return s.gz.Close()
+	}
+	return nil
+}
+
+// acceptsGzip returns true if the Accept-Encoding header allows a gzipped response
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.TrimSpace(coding) == "gzip" {
+			return strings.ReplaceAll(params, " ", "") != "q=0"
+		}
+	}
+	return false
+}
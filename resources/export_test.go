@@ -0,0 +1,168 @@
+package resources
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/list-notifications-rw/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var exportSince = time.Date(2017, 2, 1, 0, 0, 0, 0, time.UTC)
+var exportUntil = time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC)
+
+func exportNotifications() []model.InternalNotification {
+	return []model.InternalNotification{
+		{UUID: "uuid", Title: "Top Stories", EventType: "UPDATE", PublishReference: "tid_1", LastModified: exportSince.Add(time.Hour)},
+		{UUID: "uuid2", Title: "Opinion, Analysis", EventType: "DELETE", PublishReference: "tid_2", LastModified: exportSince.Add(2 * time.Hour)},
+	}
+}
+
+func export(t *testing.T, target string, headers map[string]string, mockClient *MockClient) *httptest.ResponseRecorder {
+	log := logger.NewUPPLogger("test", "debug")
+
+	req, err := http.NewRequest("GET", target, nil)
+	require.NoError(t, err)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	w := httptest.NewRecorder()
+	ExportNotifications(testMapper, mockClient, log)(w, req)
+	return w
+}
+
+func TestExportNotificationsAsNDJSON(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExportNotifications", exportSince, model.NotificationFilter{Until: exportUntil}).Return(exportNotifications(), nil)
+
+	w := export(t, "http://nothing/at/all?since=2017-02-01T00:00:00Z&until=2017-03-01T00:00:00Z", nil, mockClient)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="list-notifications-20170201T000000Z-20170301T000000Z.ndjson"`, w.Header().Get("Content-Disposition"))
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	mockClient.AssertExpectations(t)
+
+	scanner := bufio.NewScanner(w.Body)
+	var exported []model.PublicNotification
+	for scanner.Scan() {
+		var notification model.PublicNotification
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &notification), "Each line should be a notification")
+		exported = append(exported, notification)
+	}
+
+	require.Len(t, exported, 2)
+	assert.Equal(t, "http://testing-123.com/things/uuid", exported[0].ID)
+	assert.Equal(t, "tid_2", exported[1].PublishReference)
+	assert.Equal(t, "http://www.ft.com/thing/ThingChangeType/DELETE", exported[1].Type)
+}
+
+func TestExportNotificationsAsCSV(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExportNotifications", exportSince, model.NotificationFilter{Until: exportUntil}).Return(exportNotifications(), nil)
+
+	w := export(t, "http://nothing/at/all?since=2017-02-01T00:00:00Z&until=2017-03-01T00:00:00Z&format=csv", nil, mockClient)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	mockClient.AssertExpectations(t)
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, csvHeader, records[0])
+	assert.Equal(t, []string{"http://testing-123.com/things/uuid", "http://testing-123.com/lists/uuid", "http://www.ft.com/thing/ThingChangeType/UPDATE", "Top Stories", "tid_1", "2017-02-01T01:00:00Z"}, records[1])
+	assert.Equal(t, "Opinion, Analysis", records[2][3], "Titles should be quoted")
+}
+
+func TestExportNotificationsGzipped(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExportNotifications", exportSince, model.NotificationFilter{Until: exportUntil}).Return(exportNotifications(), nil)
+
+	w := export(t, "http://nothing/at/all?since=2017-02-01T00:00:00Z&until=2017-03-01T00:00:00Z&format=csv", map[string]string{"Accept-Encoding": "deflate, gzip;q=0.8"}, mockClient)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+
+	gz, err := gzip.NewReader(w.Body)
+	require.NoError(t, err)
+	records, err := csv.NewReader(gz).ReadAll()
+	require.NoError(t, err)
+	assert.Len(t, records, 3)
+}
+
+func TestExportEmptyNotifications(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExportNotifications", exportSince, model.NotificationFilter{Until: exportUntil}).Return(nil, nil)
+
+	w := export(t, "http://nothing/at/all?since=2017-02-01T00:00:00Z&until=2017-03-01T00:00:00Z&format=csv", nil, mockClient)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "id,apiUrl,type,title,publishReference,lastModified\n", w.Body.String(), "An empty export should still have a header")
+}
+
+func TestExportUncollapsedAndFilteredNotifications(t *testing.T) {
+	filter := model.NotificationFilter{
+		UUIDs:       []string{"ef863741-709a-4062-a8f1-987c44db1db5"},
+		EventTypes:  []string{"DELETE", "http://www.ft.com/thing/ThingChangeType/DELETE"},
+		Until:       exportUntil,
+		Uncollapsed: true,
+	}
+
+	mockClient := new(MockClient)
+	mockClient.On("ExportNotifications", exportSince, filter).Return(nil, nil)
+
+	w := export(t, "http://nothing/at/all?since=2017-02-01T00:00:00Z&until=2017-03-01T00:00:00Z&collapse=false&uuid=ef863741-709a-4062-a8f1-987c44db1db5&type=DELETE", nil, mockClient)
+
+	assert.Equal(t, 200, w.Code)
+	mockClient.AssertExpectations(t)
+}
+
+func TestExportInvalidParams(t *testing.T) {
+	for _, query := range []string{
+		"until=2017-03-01T00:00:00Z",
+		"since=2017-02-01T00:00:00Z",
+		"since=2017-02-01T00:00:00Z&until=2017-01-01T00:00:00Z",
+		"since=2017-02-01T00:00:00Z&until=2017-03-01T00:00:00Z&format=xml",
+		"since=2017-02-01T00:00:00Z&until=2017-03-01T00:00:00Z&collapse=maybe",
+		"since=2017-02-01T00:00:00Z&until=2017-03-01T00:00:00Z&type=PATCH",
+	} {
+		mockClient := new(MockClient)
+
+		w := export(t, "http://nothing/at/all?"+query, nil, mockClient)
+
+		assert.Equal(t, 400, w.Code, query)
+		mockClient.AssertNotCalled(t, "ExportNotifications", mock.Anything, mock.Anything)
+	}
+}
+
+func TestExportFailsBeforeWriting(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExportNotifications", exportSince, model.NotificationFilter{Until: exportUntil}).Return(nil, errors.New("no db"))
+
+	w := export(t, "http://nothing/at/all?since=2017-02-01T00:00:00Z&until=2017-03-01T00:00:00Z", nil, mockClient)
+
+	assert.Equal(t, 500, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+}
+
+func TestExportAbortsAfterWriting(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExportNotifications", exportSince, model.NotificationFilter{Until: exportUntil}).Return(exportNotifications(), errors.New("cursor killed"))
+
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		export(t, "http://nothing/at/all?since=2017-02-01T00:00:00Z&until=2017-03-01T00:00:00Z", nil, mockClient)
+	}, "An export which fails part way should be aborted, so the client sees it is incomplete")
+}
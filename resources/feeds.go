@@ -0,0 +1,249 @@
+package resources
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"mime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Financial-Times/list-notifications-rw/model"
+)
+
+// The media types a page of notifications can be rendered as; json is the default.
+const (
+	jsonType     = "application/json"
+	atomType     = "application/atom+xml"
+	rssType      = "application/rss+xml"
+	jsonFeedType = "application/feed+json"
+)
+
+const feedTitle = "List Notifications"
+
+// negotiateFormat returns the media type in the Accept header which the client prefers, and which a page can be
+// rendered as. Clients which accept none of them are sent json.
+func negotiateFormat(accept string) string {
+	format, best := jsonType, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if param, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(param, 64); err != nil {
+				continue
+			}
+		}
+
+		switch mediaType {
+		case jsonType, atomType, rssType, jsonFeedType:
+		case "*/*", "application/*":
+			mediaType = jsonType
+		default:
+			continue
+		}
+
+		if q > best {
+			format, best = mediaType, q
+		}
+	}
+	return format
+}
+
+// renderPage renders the page read from since as the media type, and returns the Content-Type to serve it with.
+func renderPage(page model.PublicNotificationPage, since time.Time, format string) (string, []byte, error) {
+	switch format {
+	case atomType:
+		body, err := renderXML(atomFeed(page, since))
+		return atomType + "; charset=utf-8", body, err
+	case rssType:
+		body, err := renderXML(rssFeed(page, since))
+		return rssType + "; charset=utf-8", body, err
+	case jsonFeedType:
+		body, err := renderJSON(jsonFeed(page))
+		return jsonFeedType, body, err
+	default:
+		body, err := renderJSON(page)
+		return jsonType, body, err
+	}
+}
+
+func renderJSON(v any) ([]byte, error) {
+	body := &bytes.Buffer{}
+	err := json.NewEncoder(body).Encode(v)
+	return body.Bytes(), err
+}
+
+func renderXML(v any) ([]byte, error) {
+	body := bytes.NewBufferString(xml.Header)
+	err := xml.NewEncoder(body).Encode(v)
+	return body.Bytes(), err
+}
+
+// feedUpdated returns when the page was last updated, i.e. the date of its newest notification, or the since date it
+// was read from if it is empty, so that an unchanged empty page renders (and is cached) the same every time
+func feedUpdated(page model.PublicNotificationPage, since time.Time) time.Time {
+	updated := newest(page.Notifications)
+	if updated.IsZero() {
+		return since.UTC()
+	}
+	return updated.UTC()
+}
+
+// entryID identifies a notification; notifications for the same list are told apart by their publishReference
+func entryID(notification model.PublicNotification) string {
+	return notification.ID + "#" + notification.PublishReference
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomEntry struct {
+	ID       string       `xml:"id"`
+	Title    string       `xml:"title"`
+	Updated  string       `xml:"updated"`
+	Link     atomLink     `xml:"link"`
+	Category atomCategory `xml:"category"`
+}
+
+type atom struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  string      `xml:"author>name"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// atomFeed renders the page as an Atom feed, whose next link pages through the feed as described by RFC 5005
+func atomFeed(page model.PublicNotificationPage, since time.Time) atom {
+	feed := atom{
+		ID:      page.RequestURL,
+		Title:   feedTitle,
+		Updated: feedUpdated(page, since).Format(time.RFC3339Nano),
+		Author:  "Financial Times",
+		Links:   []atomLink{{Rel: "self", Href: page.RequestURL}},
+	}
+	for _, link := range page.Links {
+		feed.Links = append(feed.Links, atomLink{Rel: link.Rel, Href: link.Href})
+	}
+
+	for _, n := range page.Notifications {
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:       entryID(n),
+			Title:    n.Title,
+			Updated:  n.LastModified.UTC().Format(time.RFC3339Nano),
+			Link:     atomLink{Href: n.APIURL},
+			Category: atomCategory{Term: n.Type},
+		})
+	}
+	return feed
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title    string  `xml:"title"`
+	Link     string  `xml:"link"`
+	GUID     rssGUID `xml:"guid"`
+	PubDate  string  `xml:"pubDate"`
+	Category string  `xml:"category"`
+}
+
+type rssChannel struct {
+	Title         string     `xml:"title"`
+	Link          string     `xml:"link"`
+	Description   string     `xml:"description"`
+	LastBuildDate string     `xml:"lastBuildDate"`
+	AtomLinks     []atomLink `xml:"http://www.w3.org/2005/Atom link"`
+	Items         []rssItem  `xml:"item"`
+}
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+// rssFeed renders the page as an RSS 2.0 feed; RSS has no paging links of its own, so the next link is an Atom link
+func rssFeed(page model.PublicNotificationPage, since time.Time) rss {
+	channel := rssChannel{
+		Title:         feedTitle,
+		Link:          page.RequestURL,
+		Description:   "Notifications of changes to FT lists.",
+		LastBuildDate: feedUpdated(page, since).Format(time.RFC1123Z),
+		AtomLinks:     []atomLink{{Rel: "self", Href: page.RequestURL}},
+	}
+	for _, link := range page.Links {
+		channel.AtomLinks = append(channel.AtomLinks, atomLink{Rel: link.Rel, Href: link.Href})
+	}
+
+	for _, n := range page.Notifications {
+		channel.Items = append(channel.Items, rssItem{
+			Title:    n.Title,
+			Link:     n.APIURL,
+			GUID:     rssGUID{Value: entryID(n)},
+			PubDate:  n.LastModified.UTC().Format(time.RFC1123Z),
+			Category: n.Type,
+		})
+	}
+	return rss{Version: "2.0", Channel: channel}
+}
+
+type jsonFeedItem struct {
+	ID           string                   `json:"id"`
+	URL          string                   `json:"url"`
+	Title        string                   `json:"title"`
+	DateModified string                   `json:"date_modified"`
+	Tags         []string                 `json:"tags"`
+	Notification model.PublicNotification `json:"_notification"` // the notification in its usual format, as a JSON Feed extension
+}
+
+type jsonFeedDocument struct {
+	Version string         `json:"version"`
+	Title   string         `json:"title"`
+	FeedURL string         `json:"feed_url"`
+	NextURL string         `json:"next_url,omitempty"`
+	Items   []jsonFeedItem `json:"items"`
+}
+
+// jsonFeed renders the page as a JSON Feed, whose next_url is the next link
+func jsonFeed(page model.PublicNotificationPage) jsonFeedDocument {
+	feed := jsonFeedDocument{
+		Version: "https://jsonfeed.org/version/1.1",
+		Title:   feedTitle,
+		FeedURL: page.RequestURL,
+		Items:   []jsonFeedItem{},
+	}
+	for _, link := range page.Links {
+		if link.Rel == "next" {
+			feed.NextURL = link.Href
+		}
+	}
+
+	for _, n := range page.Notifications {
+		feed.Items = append(feed.Items, jsonFeedItem{
+			ID:           entryID(n),
+			URL:          n.APIURL,
+			Title:        n.Title,
+			DateModified: n.LastModified.UTC().Format(time.RFC3339Nano),
+			Tags:         []string{n.Type},
+			Notification: n,
+		})
+	}
+	return feed
+}
@@ -0,0 +1,107 @@
+package resources
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/list-notifications-rw/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	for accept, expected := range map[string]string{
+		"":                                      jsonType,
+		"*/*":                                   jsonType,
+		"text/html":                             jsonType,
+		"application/json":                      jsonType,
+		"application/atom+xml":                  atomType,
+		"application/rss+xml, */*;q=0.1":        rssType,
+		"application/feed+json":                 jsonFeedType,
+		"application/atom+xml;q=0.5, */*":       jsonType,
+		"application/atom+xml;q=0.5, text/html": atomType,
+		"application/rss+xml;q=0.2, application/atom+xml;q=0.9": atomType,
+		"application/atom+xml;q=junk":                           jsonType,
+	} {
+		assert.Equal(t, expected, negotiateFormat(accept), accept)
+	}
+}
+
+func TestReadNotificationsAsAtom(t *testing.T) {
+	w := cachedRead(t, "http://nothing/at/all?since=2006-01-02T15:04:05Z", map[string]string{"Accept": "application/atom+xml"})
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "application/atom+xml; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "Accept", w.Header().Get("Vary"))
+
+	var feed atom
+	require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &feed))
+	assert.Equal(t, "http://www.w3.org/2005/Atom", feed.XMLName.Space)
+	assert.Equal(t, "2006-01-02T15:10:05.5Z", feed.Updated, "The feed should be updated with its newest entry")
+	require.Len(t, feed.Entries, 2)
+	assert.Equal(t, "http://testing-123.com/things/uuid#tid_1", feed.Entries[0].ID)
+	assert.Equal(t, "http://testing-123.com/lists/uuid", feed.Entries[0].Link.Href)
+	assert.Equal(t, "http://www.ft.com/thing/ThingChangeType/UPDATE", feed.Entries[0].Category.Term)
+
+	require.Len(t, feed.Links, 2)
+	assert.Equal(t, "self", feed.Links[0].Rel)
+	assert.Equal(t, "next", feed.Links[1].Rel, "The next link should page through the feed")
+	assert.Contains(t, feed.Links[1].Href, "/lists/notifications?since=")
+}
+
+func TestReadNotificationsAsRSS(t *testing.T) {
+	w := cachedRead(t, "http://nothing/at/all?since=2006-01-02T15:04:05Z", map[string]string{"Accept": "application/rss+xml"})
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "application/rss+xml; charset=utf-8", w.Header().Get("Content-Type"))
+
+	var feed rss
+	require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &feed))
+	assert.Equal(t, "2.0", feed.Version)
+	require.Len(t, feed.Channel.Items, 2)
+	assert.Equal(t, "Mon, 02 Jan 2006 15:10:05 +0000", feed.Channel.Items[1].PubDate)
+	assert.Equal(t, "http://testing-123.com/things/uuid2#tid_2", feed.Channel.Items[1].GUID.Value)
+
+	assert.Contains(t, w.Body.String(), `<link xmlns="http://www.w3.org/2005/Atom" rel="next" href="http://testing-123.com/lists/notifications?since=`, "The next link should page through the feed")
+}
+
+func TestReadNotificationsAsJSONFeed(t *testing.T) {
+	w := cachedRead(t, "http://nothing/at/all?since=2006-01-02T15:04:05Z", map[string]string{"Accept": "application/feed+json"})
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "application/feed+json", w.Header().Get("Content-Type"))
+
+	var feed jsonFeedDocument
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &feed))
+	assert.Equal(t, "https://jsonfeed.org/version/1.1", feed.Version)
+	assert.Contains(t, feed.NextURL, "/lists/notifications?since=")
+	require.Len(t, feed.Items, 2)
+	assert.Equal(t, "tid_1", feed.Items[0].Notification.PublishReference)
+	assert.Equal(t, []string{"http://www.ft.com/thing/ThingChangeType/UPDATE"}, feed.Items[0].Tags)
+}
+
+func TestFeedsHaveDifferentETags(t *testing.T) {
+	asJSON := cachedRead(t, "http://nothing/at/all?since=2006-01-02T15:04:05Z", nil)
+	asAtom := cachedRead(t, "http://nothing/at/all?since=2006-01-02T15:04:05Z", map[string]string{"Accept": "application/atom+xml"})
+
+	assert.NotEqual(t, asJSON.Header().Get("ETag"), asAtom.Header().Get("ETag"))
+}
+
+func TestEmptyFeedsAreUpdatedAtTheirSinceDate(t *testing.T) {
+	since := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	page := model.PublicNotificationPage{Notifications: []model.PublicNotification{}, Links: []model.Link{}}
+
+	_, body, err := renderPage(page, since, atomType)
+	require.NoError(t, err)
+	var feed atom
+	require.NoError(t, xml.Unmarshal(body, &feed))
+	assert.Equal(t, "2006-01-02T15:04:05Z", feed.Updated, "An empty feed should be updated at its since date, so that its ETag does not change")
+
+	_, body, err = renderPage(page, since, rssType)
+	require.NoError(t, err)
+	var channel rss
+	require.NoError(t, xml.Unmarshal(body, &channel))
+	assert.Equal(t, "Mon, 02 Jan 2006 15:04:05 +0000", channel.Channel.LastBuildDate)
+}
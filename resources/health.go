@@ -1,6 +1,7 @@
 package resources
 
 import (
+	"fmt"
 	"net/http"
 	"time"
 
@@ -13,6 +14,14 @@ type databaseHealthChecker interface {
 	Ping() error
 }
 
+type uniqueIndexChecker interface {
+	HasUniqueIndex() error
+}
+
+type outboxBacklogChecker interface {
+	OutboxBacklogAge() (time.Duration, error)
+}
+
 type HealthService struct {
 	fthealth.TimedHealthCheck
 }
@@ -28,6 +37,30 @@ func NewHealthService(db databaseHealthChecker, appSystemCode string, appName st
 	return hcService
 }
 
+// AddOutboxBacklogCheck adds a check which fails when the oldest unpublished outbox message is older than maxAge
+func (service *HealthService) AddOutboxBacklogCheck(outbox outboxBacklogChecker, maxAge time.Duration) {
+	service.Checks = append(service.Checks, fthealth.Check{
+		Name:             "List Notifications RW - Outbox is being published",
+		BusinessImpact:   "Downstream consumers of the list notifications stream will receive list changes late.",
+		TechnicalSummary: "Notifications in the outbox are not being published downstream. Check the publisher (e.g. Kafka) is reachable, and the logs for publishing errors.",
+		PanicGuide:       "https://runbooks.ftops.tech/upp-list-notifications-rw",
+		Severity:         2,
+		Checker:          checkOutboxBacklog(outbox, maxAge),
+	})
+}
+
+// AddUniqueIndexCheck adds a check which fails until the unique index on uuid and publishReference has been built
+func (service *HealthService) AddUniqueIndexCheck(db uniqueIndexChecker) {
+	service.Checks = append(service.Checks, fthealth.Check{
+		Name:             "List Notifications RW - Unique notifications index is built",
+		BusinessImpact:   "Retried list publishes may be shown to API consumers more than once.",
+		TechnicalSummary: "The unique index on uuid and publishReference has not been built, so writes are not idempotent. It cannot be built while duplicate notifications are stored; run the dedupe command once to remove them and build the index.",
+		PanicGuide:       "https://runbooks.ftops.tech/upp-list-notifications-rw",
+		Severity:         2,
+		Checker:          checkUniqueIndex(db),
+	})
+}
+
 // HealthChecksHandler HealthChecks returns a handler for the standard FT health checks
 func (service *HealthService) HealthChecksHandler() func(w http.ResponseWriter, r *http.Request) {
 	return fthealth.Handler(service)
@@ -79,3 +112,25 @@ func ensureIndexes(db databaseHealthChecker) func() (string, error) {
 		return "Database indexes are updated", nil
 	}
 }
+
+func checkUniqueIndex(db uniqueIndexChecker) func() (string, error) {
+	return func() (string, error) {
+		if err := db.HasUniqueIndex(); err != nil {
+			return "The unique notifications index is not built", err
+		}
+		return "The unique notifications index is built", nil
+	}
+}
+
+func checkOutboxBacklog(outbox outboxBacklogChecker, maxAge time.Duration) func() (string, error) {
+	return func() (string, error) {
+		age, err := outbox.OutboxBacklogAge()
+		if err != nil {
+			return "Failed to check the outbox backlog", err
+		}
+		if age > maxAge {
+			return "Outbox backlog is too old", fmt.Errorf("the oldest unpublished outbox message is %s old, which is more than %s", age.Round(time.Second), maxAge)
+		}
+		return fmt.Sprintf("The oldest unpublished outbox message is %s old", age.Round(time.Second)), nil
+	}
+}
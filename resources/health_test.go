@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	fthealth "github.com/Financial-Times/go-fthealth/v1_1"
 	status "github.com/Financial-Times/service-status-go/httphandlers"
@@ -174,3 +175,49 @@ func TestFailingDBGTG(t *testing.T) {
 	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
 	mockClient.AssertExpectations(t)
 }
+
+func TestOutboxBacklogCheck(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("OutboxBacklogAge").Return(30*time.Second, nil).Once()
+	mockClient.On("OutboxBacklogAge").Return(10*time.Minute, nil).Once()
+	mockClient.On("OutboxBacklogAge").Return(time.Duration(0), errors.New("omg")).Once()
+
+	hs := NewHealthService(mockClient, "app-system-code", "app-name", "Description of app")
+	hs.AddOutboxBacklogCheck(mockClient, 5*time.Minute)
+
+	assert.Len(t, hs.Checks, 3)
+	check := hs.Checks[2]
+	assert.Equal(t, uint8(2), check.Severity, "Severity 2")
+
+	_, err := check.Checker()
+	assert.NoError(t, err, "Backlog is within the max age")
+
+	_, err = check.Checker()
+	assert.Error(t, err, "Backlog is older than the max age")
+
+	_, err = check.Checker()
+	assert.Error(t, err, "Failed to check the backlog")
+
+	mockClient.AssertExpectations(t)
+}
+
+func TestUniqueIndexCheck(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("HasUniqueIndex").Return(nil).Once()
+	mockClient.On("HasUniqueIndex").Return(errors.New("the index has not been built")).Once()
+
+	hs := NewHealthService(mockClient, "app-system-code", "app-name", "Description of app")
+	hs.AddUniqueIndexCheck(mockClient)
+
+	assert.Len(t, hs.Checks, 3)
+	check := hs.Checks[2]
+	assert.Equal(t, uint8(2), check.Severity, "Severity 2, so the service stays ready to serve while the index is missing")
+
+	_, err := check.Checker()
+	assert.NoError(t, err, "The index is built")
+
+	_, err = check.Checker()
+	assert.Error(t, err, "The index is not built")
+
+	mockClient.AssertExpectations(t)
+}
@@ -0,0 +1,130 @@
+package resources
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/list-notifications-rw/mapping"
+	"github.com/Financial-Times/list-notifications-rw/model"
+	"github.com/gorilla/mux"
+)
+
+type historyReader interface {
+	limitGetter
+	ReadHistory(uuid string, offset int, limit int, since time.Time, until time.Time) (*[]model.InternalNotification, error)
+	ReadHistoryAfter(uuid string, lastModified time.Time, publishReference string, limit int, until time.Time) (*[]model.InternalNotification, error)
+}
+
+// ReadHistory reads every notification for a single list, oldest first, so it shows who changed the list and when.
+// Unlike ReadNotifications, the notifications for the list are not collapsed into one, and the since date is optional;
+// without one, the history starts from the list's first notification.
+func ReadHistory(mapper mapping.NotificationsMapper, nextLink mapping.NextLinkGenerator, reader historyReader, cacheDelay int, log *logger.UPPLogger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uuid := mux.Vars(r)["uuid"]
+		if !mapping.IsUUID(uuid) {
+			log.WithField("uuid", uuid).Info("User provided an invalid list uuid.")
+			writeMessage("Please specify a valid list uuid.", 400, w)
+			return
+		}
+
+		links := nextLink.WithPath("/lists/" + uuid + "/notifications")
+		params := url.Values{}
+
+		cursor, ok := getCursor(r, links, log, w)
+		if !ok {
+			return
+		}
+
+		var since time.Time
+		if cursor != nil {
+			since = cursor.LastModified
+			params.Set(mapping.CursorParam, r.URL.Query().Get(mapping.CursorParam))
+		} else if param := r.URL.Query().Get("since"); param != "" {
+			var err error
+			if since, err = time.Parse(time.RFC3339Nano, param); err != nil {
+				log.WithError(err).WithField("since", param).Info("Failed to parse user provided since date.")
+				writeMessage("Please specify an RFC3339 since date.", 400, w)
+				return
+			}
+		}
+
+		until, err := getUntil(r)
+		if err != nil {
+			log.WithError(err).Info("Failed to parse user provided until date.")
+			writeMessage("Please specify an RFC3339 until date.", 400, w)
+			return
+		}
+		if !until.IsZero() && !until.After(since) {
+			log.Infof("User provided until date which is not after the since date, until= [%v].", until.Format(time.RFC3339Nano))
+			writeMessage("Until date must be after the since date.", 400, w)
+			return
+		}
+
+		showItemChanges, err := getBoolParam(r, "itemChanges")
+		if err != nil {
+			log.WithError(err).Info("User provided itemChanges is not a boolean!")
+			writeMessage("Please specify a boolean itemChanges.", 400, w)
+			return
+		}
+
+		showMetadata, err := getBoolParam(r, "listMetadata")
+		if err != nil {
+			log.WithError(err).Info("User provided listMetadata is not a boolean!")
+			writeMessage("Please specify a boolean listMetadata.", 400, w)
+			return
+		}
+
+		offset, err := getOffset(r)
+		if err != nil {
+			log.WithError(err).Info("User provided offset is not an integer!")
+			writeMessage("Please specify an integer offset.", 400, w)
+			return
+		}
+
+		limit, err := getLimit(r, reader)
+		if err != nil {
+			log.WithError(err).Info("User provided limit is not a positive integer!")
+			writeMessage("Please specify a positive integer limit.", 400, w)
+			return
+		}
+
+		var notifications *[]model.InternalNotification
+		if cursor != nil {
+			notifications, err = reader.ReadHistoryAfter(uuid, cursor.LastModified, cursor.PublishReference, limit, until)
+		} else {
+			notifications, err = reader.ReadHistory(uuid, offset, limit, since, until)
+		}
+		if err != nil {
+			log.WithError(err).WithField("uuid", uuid).Error("Failed to query database for the history of a list!")
+			writeMessage("Failed to retrieve list notifications due to internal server error", 500, w)
+			return
+		}
+
+		if limit > 0 {
+			params.Set("limit", strconv.Itoa(limit))
+		}
+		if showItemChanges {
+			params.Set("itemChanges", "true")
+		}
+		if showMetadata {
+			params.Set("listMetadata", "true")
+		}
+
+		page := model.PublicNotificationPage{
+			Links:         []model.Link{},
+			Notifications: mapNotifications(mapper, *notifications, limit, reader, showItemChanges, showMetadata, log),
+			RequestURL:    links.ProcessRequestLink(r.URL).String(),
+		}
+
+		if link, ok := links.NextLink(since, until, offset, limit, *notifications, params); ok {
+			page.Links = append(page.Links, link)
+		} else {
+			page.LastPage = true
+		}
+
+		writePage(page, since, pageMaxAge(cacheDelay, until), w, r, log)
+	}
+}
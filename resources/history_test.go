@@ -0,0 +1,122 @@
+package resources
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/list-notifications-rw/mapping"
+	"github.com/Financial-Times/list-notifications-rw/model"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const historyUUID = "ef863741-709a-4062-a8f1-987c44db1db5"
+
+func HistoryRoute(handler func(w http.ResponseWriter, r *http.Request)) *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/lists/{uuid}/notifications", handler)
+	return r
+}
+
+func TestReadHistory(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	lastModified := time.Now().UTC().Add(-time.Hour)
+
+	req, _ := http.NewRequest("GET", "http://our.host.name/lists/"+historyUUID+"/notifications?limit=2", nil)
+	w := httptest.NewRecorder()
+
+	history := []model.InternalNotification{
+		{UUID: historyUUID, EventType: "CREATE", PublishReference: "tid_1", LastModified: lastModified},
+		{UUID: historyUUID, EventType: "UPDATE", PublishReference: "tid_2", LastModified: lastModified.Add(time.Minute)},
+		{UUID: historyUUID, EventType: "UPDATE", PublishReference: "tid_3", LastModified: lastModified.Add(2 * time.Minute)},
+	}
+
+	mockClient := new(MockClient)
+	mockClient.On("GetLimit").Return(200)
+	mockClient.On("ReadHistory", historyUUID, 0, 2, time.Time{}, time.Time{}).Return(&history, nil)
+
+	HistoryRoute(ReadHistory(testMapper, testLinkGenerator, mockClient, 10, log)).ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	mockClient.AssertExpectations(t)
+
+	var page model.PublicNotificationPage
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&page))
+	require.Len(t, page.Notifications, 2, "Every notification for the list should be returned, up to the limit")
+	assert.Equal(t, "tid_1", page.Notifications[0].PublishReference)
+	assert.Equal(t, "http://www.ft.com/thing/ThingChangeType/CREATE", page.Notifications[0].Type)
+	assert.Equal(t, lastModified.Add(time.Minute), page.Notifications[1].LastModified)
+
+	require.Len(t, page.Links, 1)
+	next, err := url.Parse(page.Links[0].Href)
+	require.NoError(t, err)
+	assert.Equal(t, "/lists/"+historyUUID+"/notifications", next.Path)
+	assert.Equal(t, "2", next.Query().Get("limit"))
+	assert.Equal(t, lastModified.Add(time.Minute+10*time.Second).Format(time.RFC3339Nano), next.Query().Get("since"))
+}
+
+func TestReadHistoryWithCursor(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	lastModified := time.Now().UTC().Add(-time.Hour)
+	cursorLink := mapping.CursorNextLink{ApiHost: "testing-123.com", CacheDelay: 10, MaxLimit: 1, Secret: []byte("secret")}
+
+	first := []model.InternalNotification{
+		{UUID: historyUUID, EventType: "UPDATE", PublishReference: "tid_1", LastModified: lastModified},
+		{UUID: historyUUID, EventType: "UPDATE", PublishReference: "tid_2", LastModified: lastModified},
+	}
+	link, ok := cursorLink.WithPath("/lists/"+historyUUID+"/notifications").NextLink(lastModified, time.Time{}, 0, 0, first, nil)
+	require.True(t, ok)
+
+	req, _ := http.NewRequest("GET", link.Href, nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockClient.On("GetLimit").Return(1)
+	mockClient.On("ReadHistoryAfter", historyUUID, lastModified, "tid_1", 0, time.Time{}).Return(&[]model.InternalNotification{first[1]}, nil)
+
+	HistoryRoute(ReadHistory(testMapper, cursorLink, mockClient, 10, log)).ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	mockClient.AssertExpectations(t)
+}
+
+func TestReadHistoryInvalidRequests(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+
+	for _, path := range []string{
+		"/lists/not-a-uuid/notifications",
+		"/lists/" + historyUUID + "/notifications?since=yesterday",
+		"/lists/" + historyUUID + "/notifications?since=2017-02-02T12:51:00Z&until=2017-02-01T12:51:00Z",
+		"/lists/" + historyUUID + "/notifications?limit=-1",
+		"/lists/" + historyUUID + "/notifications?cursor=abc",
+	} {
+		req, _ := http.NewRequest("GET", "http://our.host.name"+path, nil)
+		w := httptest.NewRecorder()
+
+		mockClient := new(MockClient)
+		mockClient.On("GetLimit").Return(200)
+		HistoryRoute(ReadHistory(testMapper, testLinkGenerator, mockClient, 10, log)).ServeHTTP(w, req)
+
+		assert.Equal(t, 400, w.Code, path)
+	}
+}
+
+func TestReadHistoryFails(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("GET", "http://our.host.name/lists/"+historyUUID+"/notifications", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockClient.On("ReadHistory", historyUUID, 0, 0, time.Time{}, time.Time{}).Return(nil, errors.New("mongo is down"))
+
+	HistoryRoute(ReadHistory(testMapper, testLinkGenerator, mockClient, 10, log)).ServeHTTP(w, req)
+
+	assert.Equal(t, 500, w.Code)
+}
@@ -1,6 +1,7 @@
 package resources
 
 import (
+	"context"
 	"net/http"
 	"time"
 
@@ -33,8 +34,18 @@ func (m *MockClient) Ping() error {
 	return args.Error(0)
 }
 
-func (m *MockClient) ReadNotifications(offset int, since time.Time) (*[]model.InternalNotification, error) {
-	args := m.Called(offset, since)
+func (m *MockClient) ReadNotifications(offset int, limit int, since time.Time, filter model.NotificationFilter) (*[]model.InternalNotification, error) {
+	args := m.Called(offset, limit, since, filter)
+	notifications := args.Get(0)
+	if notifications == nil {
+		return nil, args.Error(1)
+	}
+
+	return notifications.(*[]model.InternalNotification), args.Error(1)
+}
+
+func (m *MockClient) ReadNotificationsAfter(lastModified time.Time, uuid string, publishReference string, limit int, filter model.NotificationFilter) (*[]model.InternalNotification, error) {
+	args := m.Called(lastModified, uuid, publishReference, limit, filter)
 	notifications := args.Get(0)
 	if notifications == nil {
 		return nil, args.Error(1)
@@ -63,11 +74,41 @@ func (m *MockClient) FindNotificationByPartialTransactionID(transactionID string
 	return notifications.(model.InternalNotification), args.Error(1)
 }
 
+func (m *MockClient) FindRecordedNotification(uuid string, publishReference string) (model.InternalNotification, error) {
+	args := m.Called(uuid, publishReference)
+	return args.Get(0).(model.InternalNotification), args.Error(1)
+}
+
+func (m *MockClient) FindLatestNotification(uuid string) (model.InternalNotification, error) {
+	args := m.Called(uuid)
+	notification := args.Get(0)
+	if notification == nil {
+		return model.InternalNotification{}, args.Error(1)
+	}
+
+	return notification.(model.InternalNotification), args.Error(1)
+}
+
 func (m *MockClient) WriteNotification(notification *model.InternalNotification) error {
 	args := m.Called(notification)
 	return args.Error(0)
 }
 
+func (m *MockClient) WriteNotifications(notifications []*model.InternalNotification) error {
+	args := m.Called(notifications)
+	return args.Error(0)
+}
+
+func (m *MockClient) OutboxBacklogAge() (time.Duration, error) {
+	args := m.Called()
+	return args.Get(0).(time.Duration), args.Error(1)
+}
+
+func (m *MockClient) HasUniqueIndex() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
 func (m *MockClient) EnsureIndexes() error {
 	args := m.Called()
 	return args.Error(0)
@@ -77,3 +118,80 @@ func (m *MockClient) Close() error {
 	args := m.Called()
 	return args.Error(0)
 }
+
+func (m *MockClient) CreateSubscription(subscription model.Subscription) error {
+	args := m.Called(subscription)
+	return args.Error(0)
+}
+
+func (m *MockClient) ReadSubscriptions() ([]model.Subscription, error) {
+	args := m.Called()
+	subscriptions := args.Get(0)
+	if subscriptions == nil {
+		return nil, args.Error(1)
+	}
+
+	return subscriptions.([]model.Subscription), args.Error(1)
+}
+
+func (m *MockClient) FindSubscription(id string) (model.Subscription, error) {
+	args := m.Called(id)
+	return args.Get(0).(model.Subscription), args.Error(1)
+}
+
+func (m *MockClient) UpdateSubscription(subscription model.Subscription) error {
+	args := m.Called(subscription)
+	return args.Error(0)
+}
+
+func (m *MockClient) DeleteSubscription(id string) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockClient) ReadHistory(uuid string, offset int, limit int, since time.Time, until time.Time) (*[]model.InternalNotification, error) {
+	args := m.Called(uuid, offset, limit, since, until)
+	notifications := args.Get(0)
+	if notifications == nil {
+		return nil, args.Error(1)
+	}
+
+	return notifications.(*[]model.InternalNotification), args.Error(1)
+}
+
+func (m *MockClient) ReadHistoryAfter(uuid string, lastModified time.Time, publishReference string, limit int, until time.Time) (*[]model.InternalNotification, error) {
+	args := m.Called(uuid, lastModified, publishReference, limit, until)
+	notifications := args.Get(0)
+	if notifications == nil {
+		return nil, args.Error(1)
+	}
+
+	return notifications.(*[]model.InternalNotification), args.Error(1)
+}
+
+func (m *MockClient) ExportNotifications(ctx context.Context, since time.Time, filter model.NotificationFilter, export func(notification model.InternalNotification) error) error {
+	args := m.Called(since, filter)
+	if notifications, ok := args.Get(0).([]model.InternalNotification); ok {
+		for _, n := range notifications {
+			if err := export(n); err != nil {
+				return err
+			}
+		}
+	}
+	return args.Error(1)
+}
+
+func (m *MockClient) CountNotificationsBetween(since time.Time, until time.Time, filter model.NotificationFilter) (int64, error) {
+	args := m.Called(since, until, filter)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockClient) FindNotificationsByTransactionID(transactionID string, prefix bool) ([]model.InternalNotification, error) {
+	args := m.Called(transactionID, prefix)
+	notifications := args.Get(0)
+	if notifications == nil {
+		return nil, args.Error(1)
+	}
+
+	return notifications.([]model.InternalNotification), args.Error(1)
+}
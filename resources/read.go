@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Financial-Times/go-logger/v2"
@@ -12,33 +14,156 @@ import (
 	"github.com/Financial-Times/list-notifications-rw/model"
 )
 
-type notificationReader interface {
-	ReadNotifications(offset int, since time.Time) (*[]model.InternalNotification, error)
+type limitGetter interface {
 	GetLimit() int
 }
 
-// ReadNotifications reads notifications from the backing db
-func ReadNotifications(mapper mapping.NotificationsMapper, nextLink mapping.NextLinkGenerator, reader notificationReader, maxSinceInterval int, log *logger.UPPLogger) func(w http.ResponseWriter, r *http.Request) {
+type notificationReader interface {
+	limitGetter
+	ReadNotifications(offset int, limit int, since time.Time, filter model.NotificationFilter) (*[]model.InternalNotification, error)
+	ReadNotificationsAfter(lastModified time.Time, uuid string, publishReference string, limit int, filter model.NotificationFilter) (*[]model.InternalNotification, error)
+	CountNotificationsBetween(since time.Time, until time.Time, filter model.NotificationFilter) (int64, error)
+}
+
+// maxUUIDFilters caps the list uuids to filter on. The uuids token of a POSTed set takes about 21 characters per uuid,
+// so at this cap its next links still fit within the 8KB url limit of common proxies and CDNs.
+const maxUUIDFilters = 300
+
+// ReadNotifications reads notifications from the backing db. By default, the notifications for each list are collapsed
+// into the latest one; collapse=false reads every notification instead. The notifications can be filtered to specific
+// lists with repeated uuid query parameters, or for long sets of lists, by POSTing a json body of {"uuids": [...]}.
+// With a wait query parameter, an empty page is held open until there are notifications to read, or the wait expires;
+// the notifier (if any) wakes the reader when this instance writes a notification.
+// Pages are json, unless the Accept header asks for an Atom, RSS or JSON Feed, whose paging link is the next link.
+// The since date may be given in several formats (see parseSince); since=now returns an empty page whose next link reads
+// the notifications written from now on. A since date older than the max since interval is rejected, unless clamp=true,
+// which reads from the oldest permitted date instead, and reports how many notifications were skipped.
+// Pages may be cached for the cache delay, or for longer once their until date is past it, as they can no longer change.
+func ReadNotifications(mapper mapping.NotificationsMapper, nextLink mapping.NextLinkGenerator, reader notificationReader, notifier *Notifier, maxSinceInterval int, cacheDelay int, log *logger.UPPLogger) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		param := r.URL.Query().Get("since")
-		if param == "" {
-			log.Info("User didn't provide since date.")
-			writeMessage(sinceMessage(), 400, w)
+		params := url.Values{}
+
+		cursor, ok := getCursor(r, nextLink, log, w)
+		if !ok {
 			return
 		}
+		if cursor != nil {
+			params.Set(mapping.CursorParam, r.URL.Query().Get(mapping.CursorParam))
+		}
 
-		since, err := time.Parse(time.RFC3339Nano, param)
+		clamp, err := getBoolParam(r, "clamp")
 		if err != nil {
-			log.WithError(err).WithField("since", param).Info("Failed to parse user provided since date.")
-			writeMessage(sinceMessage(), 400, w)
+			log.WithError(err).Info("User provided clamp is not a boolean!")
+			writeMessage("Please specify a boolean clamp.", 400, w)
 			return
 		}
-		if since.Before(time.Now().UTC().AddDate(0, 0, -maxSinceInterval)) {
-			log.Infof("User provided since date before query cap date, since= [%v].", since.Format(time.RFC3339Nano))
-			writeMessage(fmt.Sprintf("Since date must be within the last %d days.", maxSinceInterval), 400, w)
+
+		var since time.Time
+		fromNow := false
+		if cursor != nil {
+			since = cursor.LastModified
+		} else {
+			param := r.URL.Query().Get("since")
+			if param == "" {
+				log.Info("User didn't provide since date.")
+				writeMessage(sinceMessage(), 400, w)
+				return
+			}
+
+			since, err = parseSince(param, time.Now())
+			if err != nil {
+				log.WithError(err).WithField("since", param).Info("Failed to parse user provided since date.")
+				writeMessage(sinceMessage(), 400, w)
+				return
+			}
+			fromNow = strings.EqualFold(param, sinceNow)
+		}
+
+		var truncation *model.Truncation
+		if earliest := time.Now().UTC().AddDate(0, 0, -maxSinceInterval); since.Before(earliest) {
+			if !clamp {
+				log.Infof("User provided since date before query cap date, since= [%v].", since.Format(time.RFC3339Nano))
+				writeMessage(fmt.Sprintf("Since date must be within the last %d days.", maxSinceInterval), 400, w)
+				return
+			}
+
+			log.Infof("Clamping user provided since date before query cap date, since= [%v].", since.Format(time.RFC3339Nano))
+			truncation = &model.Truncation{RequestedSince: since, Since: earliest}
+			since = earliest
+			cursor = nil // the cursor's position is before the cap, so read from the cap instead
+			params.Del(mapping.CursorParam)
+		}
+
+		until, err := getUntil(r)
+		if err != nil {
+			log.WithError(err).Info("Failed to parse user provided until date.")
+			writeMessage("Please specify an RFC3339 until date.", 400, w)
+			return
+		}
+		if !until.IsZero() && !until.After(since) {
+			log.Infof("User provided until date which is not after the since date, until= [%v].", until.Format(time.RFC3339Nano))
+			writeMessage("Until date must be after the since date.", 400, w)
 			return
 		}
 
+		showItemChanges, err := getBoolParam(r, "itemChanges")
+		if err != nil {
+			log.WithError(err).Info("User provided itemChanges is not a boolean!")
+			writeMessage("Please specify a boolean itemChanges.", 400, w)
+			return
+		}
+
+		showMetadata, err := getBoolParam(r, "listMetadata")
+		if err != nil {
+			log.WithError(err).Info("User provided listMetadata is not a boolean!")
+			writeMessage("Please specify a boolean listMetadata.", 400, w)
+			return
+		}
+
+		uuids, err := getUUIDs(r)
+		if err != nil {
+			log.WithError(err).Info("User provided invalid uuids!")
+			writeMessage(fmt.Sprintf("Please specify up to %d valid list uuids.", maxUUIDFilters), 400, w)
+			return
+		}
+
+		uuidsToken, err := carriedUUIDs(r, uuids)
+		if err != nil {
+			log.WithError(err).Info("User provided uuids which cannot be carried forward!")
+			writeMessage(fmt.Sprintf("Please specify up to %d valid list uuids.", maxUUIDFilters), 400, w)
+			return
+		}
+
+		eventTypes, err := getEventTypes(r)
+		if err != nil {
+			log.WithError(err).Info("User provided an unknown event type!")
+			writeMessage("Please specify a known event type (CREATE, UPDATE, DELETE).", 400, w)
+			return
+		}
+
+		collapse, err := getCollapse(r)
+		if err != nil {
+			log.WithError(err).Info("User provided collapse is not a boolean!")
+			writeMessage("Please specify a boolean collapse.", 400, w)
+			return
+		}
+		if showItemChanges && collapse { // a collapsed notification only has the item changes of the list's latest notification
+			log.Info("User provided itemChanges without collapse=false.")
+			writeMessage("Item changes are only shown for every notification; please specify collapse=false with itemChanges.", 400, w)
+			return
+		}
+
+		filter := model.NotificationFilter{UUIDs: uuids, EventTypes: eventTypes, Until: until, Uncollapsed: !collapse}
+
+		if truncation != nil {
+			truncation.Missed, err = reader.CountNotificationsBetween(truncation.RequestedSince, truncation.Since, model.NotificationFilter{UUIDs: uuids, EventTypes: eventTypes})
+			if err != nil {
+				log.WithError(err).Error("Failed to count notifications before the query cap date!")
+				writeMessage("Failed to retrieve list notifications due to internal server error", 500, w)
+				return
+			}
+		}
+
 		offset, err := getOffset(r)
 
 		if err != nil {
@@ -47,36 +172,179 @@ func ReadNotifications(mapper mapping.NotificationsMapper, nextLink mapping.Next
 			return
 		}
 
-		notifications, err := reader.ReadNotifications(offset, since)
+		limit, err := getLimit(r, reader)
+		if err != nil {
+			log.WithError(err).Info("User provided limit is not a positive integer!")
+			writeMessage("Please specify a positive integer limit.", 400, w)
+			return
+		}
+
+		wait, err := getWait(r)
+		if err != nil {
+			log.WithError(err).Info("User provided an invalid wait!")
+			writeMessage(fmt.Sprintf("Please specify a wait duration of up to %v, e.g. wait=30s.", maxWait), 400, w)
+			return
+		}
+
+		read := func() (*[]model.InternalNotification, error) {
+			if cursor != nil {
+				return reader.ReadNotificationsAfter(cursor.LastModified, cursor.UUID, cursor.PublishReference, limit, filter)
+			}
+			return reader.ReadNotifications(offset, limit, since, filter)
+		}
+
+		// nothing can be read from now yet, so the page is empty, and its next link is where to start reading from
+		notifications := &[]model.InternalNotification{}
+		if !fromNow {
+			notifications, err = read()
+		}
+		if err == nil && len(*notifications) == 0 && wait > 0 {
+			notifications, err = waitForNotifications(r.Context(), wait, waitPollInterval, notifier, read)
+		}
 		if err != nil {
 			log.WithError(err).Error("Failed to query database for notifications!")
 			writeMessage("Failed to retrieve list notifications due to internal server error", 500, w)
 			return
 		}
 
-		results := make([]model.PublicNotification, 0)
-		for i, n := range *notifications {
-			if i >= reader.GetLimit() {
-				break
+		results := mapNotifications(mapper, *notifications, limit, reader, showItemChanges, showMetadata, log)
+
+		if uuidsToken != "" {
+			params.Set(mapping.UUIDsParam, uuidsToken)
+		} else {
+			for _, uuid := range r.URL.Query()["uuid"] {
+				params.Add("uuid", uuid)
 			}
-			results = append(results, mapper.MapInternalNotificationToPublic(n))
+		}
+		for _, eventType := range r.URL.Query()["type"] {
+			params.Add("type", eventType)
+		}
+		if limit > 0 {
+			params.Set("limit", strconv.Itoa(limit))
+		}
+		if wait > 0 {
+			params.Set("wait", wait.String())
+		}
+		if showItemChanges {
+			params.Set("itemChanges", "true")
+		}
+		if showMetadata {
+			params.Set("listMetadata", "true")
+		}
+		if !collapse {
+			params.Set("collapse", "false")
+		}
+		if clamp {
+			params.Set("clamp", "true")
 		}
 
 		page := model.PublicNotificationPage{
-			Links: []model.Link{
-				nextLink.NextLink(since, offset, *notifications),
-			},
+			Links:         []model.Link{},
 			Notifications: results,
 			RequestURL:    nextLink.ProcessRequestLink(r.URL).String(),
+			Truncated:     truncation,
 		}
 
-		w.Header().Add("Content-Type", "application/json")
+		if link, ok := nextLink.NextLink(since, until, offset, limit, *notifications, params); ok {
+			page.Links = append(page.Links, link)
+		} else {
+			page.LastPage = true // the until date has passed, and there are no more notifications before it
+		}
+
+		if truncation != nil {
+			w.Header().Set("X-Since-Truncated", "true")
+			w.Header().Set("X-Notifications-Missed", strconv.FormatInt(truncation.Missed, 10))
+		}
+		writePage(page, since, pageMaxAge(cacheDelay, until), w, r, log)
+	}
+}
+
+// getCursor reads the cursor from the query, if there is one, and responds to the request if it is invalid.
+func getCursor(r *http.Request, nextLink mapping.NextLinkGenerator, log *logger.UPPLogger, w http.ResponseWriter) (*mapping.Cursor, bool) {
+	param := r.URL.Query().Get(mapping.CursorParam)
+	if param == "" {
+		return nil, true
+	}
 
-		encoder := json.NewEncoder(w)
-		if err = encoder.Encode(page); err != nil {
-			log.WithError(err).Error("Failed to encode page")
+	parser, ok := nextLink.(mapping.CursorParser)
+	if !ok {
+		log.Info("User provided a cursor, but cursors are not enabled.")
+		writeMessage("Cursors are not supported; please use the since and offset parameters.", 400, w)
+		return nil, false
+	}
+
+	cursor, err := parser.ParseCursor(param)
+	if err != nil {
+		log.WithError(err).WithField("cursor", param).Info("Failed to parse user provided cursor.")
+		writeMessage("Invalid cursor; please use the cursor from the next link of a previous page.", 400, w)
+		return nil, false
+	}
+	return &cursor, true
+}
+
+// mapNotifications maps the first page of notifications to the public format, skipping any which cannot be mapped.
+func mapNotifications(mapper mapping.NotificationsMapper, notifications []model.InternalNotification, limit int, limiter limitGetter, showItemChanges bool, showMetadata bool, log *logger.UPPLogger) []model.PublicNotification {
+	results := make([]model.PublicNotification, 0)
+	for i, n := range notifications {
+		if i >= mapping.PageLimit(limit, limiter.GetLimit()) {
+			break
+		}
+		public, err := mapper.MapInternalNotificationToPublic(n)
+		if err != nil {
+			log.WithError(err).WithField("uuid", n.UUID).WithField("transaction_id", n.PublishReference).Warn("Skipping notification which cannot be mapped to the public format.")
+			continue
+		}
+		if showItemChanges {
+			public = withItemChanges(public, n)
 		}
+		if showMetadata {
+			public = withMetadata(public, n)
+		}
+		results = append(results, public)
+	}
+	return results
+}
+
+// getLimit reads the page size requested by the user, capped at the max limit; zero means the user didn't request one.
+func getLimit(r *http.Request, reader limitGetter) (int, error) {
+	param := r.URL.Query().Get("limit")
+	if param == "" {
+		return 0, nil
+	}
+
+	limit, err := strconv.Atoi(param)
+	if err != nil {
+		return 0, err
+	}
+	if limit < 1 {
+		return 0, fmt.Errorf("limit %d is not positive", limit)
+	}
+
+	return mapping.PageLimit(limit, reader.GetLimit()), nil
+}
+
+func getWait(r *http.Request) (time.Duration, error) {
+	param := r.URL.Query().Get("wait")
+	if param == "" {
+		return 0, nil
+	}
+
+	wait, err := time.ParseDuration(param)
+	if err != nil {
+		return 0, err
+	}
+	if wait < 0 || wait > maxWait {
+		return 0, fmt.Errorf("wait %v is not between 0 and %v", wait, maxWait)
+	}
+	return wait, nil
+}
+
+func getUntil(r *http.Request) (time.Time, error) {
+	param := r.URL.Query().Get("until")
+	if param == "" {
+		return time.Time{}, nil
 	}
+	return time.Parse(time.RFC3339Nano, param)
 }
 
 func getOffset(r *http.Request) (offset int, err error) {
@@ -90,6 +358,99 @@ func getOffset(r *http.Request) (offset int, err error) {
 	return offset, err
 }
 
+// getUUIDs reads the list uuids to filter on from the query, and for POST requests, the body.
+func getUUIDs(r *http.Request) ([]string, error) {
+	var uuids []string
+	uuids = append(uuids, r.URL.Query()["uuid"]...)
+
+	if token := r.URL.Query().Get(mapping.UUIDsParam); token != "" {
+		carried, err := mapping.DecodeUUIDs(token)
+		if err != nil {
+			return nil, err
+		}
+		uuids = append(uuids, carried...)
+	}
+
+	if r.Method == http.MethodPost {
+		body := struct {
+			UUIDs []string `json:"uuids"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			return nil, err
+		}
+		uuids = append(uuids, body.UUIDs...)
+	}
+
+	if len(uuids) > maxUUIDFilters {
+		return nil, fmt.Errorf("too many uuids: %d", len(uuids))
+	}
+
+	for _, uuid := range uuids {
+		if !mapping.IsUUID(uuid) {
+			return nil, fmt.Errorf("invalid uuid: %q", uuid)
+		}
+	}
+
+	return uuids, nil
+}
+
+// carriedUUIDs packs the uuids of POST requests (and of the GET requests which follow their next links) into a token,
+// as uuids POSTed in the body may be too many to carry forward as uuid parameters.
+func carriedUUIDs(r *http.Request, uuids []string) (string, error) {
+	if len(uuids) == 0 || (r.Method != http.MethodPost && r.URL.Query().Get(mapping.UUIDsParam) == "") {
+		return "", nil
+	}
+	return mapping.EncodeUUIDs(uuids)
+}
+
+// getEventTypes reads the event types to filter on from the query, and returns every matching stored eventType value.
+func getEventTypes(r *http.Request) ([]string, error) {
+	var eventTypes []string
+	for _, param := range r.URL.Query()["type"] {
+		stored, err := mapping.StoredEventTypes(param)
+		if err != nil {
+			return nil, err
+		}
+		eventTypes = append(eventTypes, stored...)
+	}
+	return eventTypes, nil
+}
+
+// getCollapse reads whether the notifications for each list should be collapsed into the latest one, which is the default.
+func getCollapse(r *http.Request) (bool, error) {
+	param := r.URL.Query().Get("collapse")
+	if param == "" {
+		return true, nil
+	}
+	return strconv.ParseBool(param)
+}
+
+func getBoolParam(r *http.Request, name string) (bool, error) {
+	param := r.URL.Query().Get(name)
+	if param == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(param)
+}
+
+// withItemChanges adds the item changes recorded against the internal notification to the public notification
+func withItemChanges(public model.PublicNotification, notification model.InternalNotification) model.PublicNotification {
+	reordered := notification.Reordered
+
+	public.AddedItems = notification.AddedItems
+	public.RemovedItems = notification.RemovedItems
+	public.Reordered = &reordered
+	return public
+}
+
+// withMetadata adds the list metadata recorded against the internal notification to the public notification
+func withMetadata(public model.PublicNotification, notification model.InternalNotification) model.PublicNotification {
+	public.LayoutHint = notification.LayoutHint
+	public.ListType = notification.ListType
+	public.Concept = notification.Concept
+	return public
+}
+
 func sinceMessage() string {
-	return fmt.Sprintf("A mandatory 'since' query parameter has not been specified. Please supply a since date. For eg., since=%s .", time.Now().UTC().AddDate(0, 0, -1).Format(time.RFC3339Nano))
+	return fmt.Sprintf("A mandatory 'since' query parameter has not been specified. Please supply a since date. For eg., since=%s . The since date may also be epoch seconds or millis, a duration before now (e.g. since=-PT1H), or since=now to read from now on.", time.Now().UTC().AddDate(0, 0, -1).Format(time.RFC3339Nano))
 }
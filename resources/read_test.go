@@ -1,17 +1,23 @@
 package resources
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/list-notifications-rw/mapping"
 	"github.com/Financial-Times/list-notifications-rw/model"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 func TestReadNotifications(t *testing.T) {
@@ -43,9 +49,9 @@ func TestReadNotifications(t *testing.T) {
 		},
 	}
 
-	mockClient.On("ReadNotifications", 0, mockSince).Return(&mockNotifications, nil)
+	mockClient.On("ReadNotifications", 0, 0, mockSince, model.NotificationFilter{}).Return(&mockNotifications, nil)
 
-	ReadNotifications(testMapper, testLinkGenerator, mockClient, 10000, log)(w, req)
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
 
 	assert.Equal(t, 200, w.Code, "Everything should be OK but we didn't return 200!")
 	assert.Equal(t, "application/json", w.Header().Get("Content-Type"), "Everything should be OK but we didn't return json!")
@@ -84,9 +90,9 @@ func TestReadNoNotifications(t *testing.T) {
 	//Important Ft.com expects [] not nil
 	mockNotifications := make([]model.InternalNotification, 0)
 
-	mockClient.On("ReadNotifications", 0, mockSince).Return(&mockNotifications, nil)
+	mockClient.On("ReadNotifications", 0, 0, mockSince, model.NotificationFilter{}).Return(&mockNotifications, nil)
 
-	ReadNotifications(testMapper, testLinkGenerator, mockClient, 10000, log)(w, req)
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
 
 	assert.Equal(t, 200, w.Code, "Everything should be OK but we didn't return 200!")
 	assert.Equal(t, "application/json", w.Header().Get("Content-Type"), "Everything should be OK but we didn't return json!")
@@ -108,7 +114,7 @@ func Test400NoSinceDate(t *testing.T) {
 	w := httptest.NewRecorder()
 
 	mockClient := new(MockClient)
-	ReadNotifications(testMapper, testLinkGenerator, mockClient, 10000, log)(w, req)
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
 
 	assert.Equal(t, 400, w.Code, "No since date, should be 400!")
 	assert.True(t, strings.Contains(w.Body.String(), "{\"message\":\"A mandatory 'since' query parameter has not been specified. Please supply a since date. For eg., since="), "Did not receive expected error message for missing since date")
@@ -123,7 +129,7 @@ func Test400JunkSinceDate(t *testing.T) {
 	w := httptest.NewRecorder()
 
 	mockClient := new(MockClient)
-	ReadNotifications(testMapper, testLinkGenerator, mockClient, 10000, log)(w, req)
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
 
 	assert.Equal(t, 400, w.Code, "The since date was garbage! Should be 400!")
 	assert.True(t, strings.Contains(w.Body.String(), "{\"message\":\"A mandatory 'since' query parameter has not been specified. Please supply a since date. For eg., since="), "Did not receive expected error message junk since date")
@@ -137,7 +143,7 @@ func Test400SinceDateTooEarly(t *testing.T) {
 	w := httptest.NewRecorder()
 
 	mockClient := new(MockClient)
-	ReadNotifications(testMapper, testLinkGenerator, mockClient, 90, log)(w, req)
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 90, 10, log)(w, req)
 
 	assert.Equal(t, 400, w.Code, "Since date too early, should be 400!")
 	assert.Equal(t, "{\"message\":\"Since date must be within the last 90 days.\"}\n", w.Body.String(), "Did not receive correct error message for since date before max time interval")
@@ -152,9 +158,9 @@ func TestFailedDatabaseOnRead(t *testing.T) {
 	mockSince, _ := time.Parse(time.RFC3339Nano, "2006-01-02T15:04:05.999Z")
 
 	mockClient := new(MockClient)
-	mockClient.On("ReadNotifications", 0, mockSince).Return(nil, errors.New("I broke soz"))
+	mockClient.On("ReadNotifications", 0, 0, mockSince, model.NotificationFilter{}).Return(nil, errors.New("I broke soz"))
 
-	ReadNotifications(testMapper, testLinkGenerator, mockClient, 10000, log)(w, req)
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
 
 	assert.Equal(t, 500, w.Code, "Database was broken but we didn't return 500!")
 	assert.Equal(t, "{\"message\":\"Failed to retrieve list notifications due to internal server error\"}\n", w.Body.String(), "Did not receive expected error message database read fail")
@@ -169,7 +175,7 @@ func TestInvalidOffset(t *testing.T) {
 	w := httptest.NewRecorder()
 
 	mockClient := new(MockClient)
-	ReadNotifications(testMapper, testLinkGenerator, mockClient, 10000, log)(w, req)
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
 
 	assert.Equal(t, 400, w.Code, "Offset was invalid but we didn't 400!")
 	assert.Equal(t, "{\"message\":\"Please specify an integer offset.\"}\n", w.Body.String(), "Did not receive expected  error message for invalid offset")
@@ -186,9 +192,9 @@ func TestFailedToQueryAndOffset(t *testing.T) {
 
 	mockClient := new(MockClient)
 
-	mockClient.On("ReadNotifications", 100, mockSince).Return(nil, errors.New("I broke again soz"))
+	mockClient.On("ReadNotifications", 100, 0, mockSince, model.NotificationFilter{}).Return(nil, errors.New("I broke again soz"))
 
-	ReadNotifications(testMapper, testLinkGenerator, mockClient, 10000, log)(w, req)
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
 
 	assert.Equal(t, 500, w.Code, "Database failed to query but we didn't return 500!")
 	assert.Equal(t, "{\"message\":\"Failed to retrieve list notifications due to internal server error\"}\n", w.Body.String(), "Did not receive expected error message database read fail")
@@ -196,3 +202,857 @@ func TestFailedToQueryAndOffset(t *testing.T) {
 	mockClient.AssertExpectations(t)
 	t.Log("Recorded 500 response as expected, and since date was accepted.")
 }
+
+func TestReadDeleteNotification(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	mockSince, _ := time.Parse(time.RFC3339Nano, "2006-01-02T15:04:05.99999Z")
+
+	req, _ := http.NewRequest("GET", "http://nothing/at/all?since=2006-01-02T15:04:05.99999Z", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockClient.On("GetLimit").Return(200)
+
+	mockNotifications := []model.InternalNotification{
+		{
+			UUID:             "uuid",
+			LastModified:     time.Now(),
+			EventType:        "DELETE",
+			PublishReference: "tid_blah-blah-blah",
+		},
+	}
+
+	mockClient.On("ReadNotifications", 0, 0, mockSince, model.NotificationFilter{}).Return(&mockNotifications, nil)
+
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
+
+	assert.Equal(t, 200, w.Code)
+
+	page := model.PublicNotificationPage{}
+	err := json.NewDecoder(w.Body).Decode(&page)
+	assert.NoError(t, err)
+
+	assert.Len(t, page.Notifications, 1)
+	assert.Equal(t, "http://www.ft.com/thing/ThingChangeType/DELETE", page.Notifications[0].Type)
+	mockClient.AssertExpectations(t)
+}
+
+func TestReadSkipsUnknownEventType(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	mockSince, _ := time.Parse(time.RFC3339Nano, "2006-01-02T15:04:05.99999Z")
+
+	req, _ := http.NewRequest("GET", "http://nothing/at/all?since=2006-01-02T15:04:05.99999Z", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockClient.On("GetLimit").Return(200)
+
+	mockNotifications := []model.InternalNotification{
+		{
+			UUID:         "uuid",
+			LastModified: time.Now(),
+			EventType:    "PUBLISH",
+		},
+		{
+			UUID:         "uuid2",
+			LastModified: time.Now(),
+			EventType:    "UPDATE",
+		},
+	}
+
+	mockClient.On("ReadNotifications", 0, 0, mockSince, model.NotificationFilter{}).Return(&mockNotifications, nil)
+
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
+
+	assert.Equal(t, 200, w.Code)
+
+	page := model.PublicNotificationPage{}
+	err := json.NewDecoder(w.Body).Decode(&page)
+	assert.NoError(t, err)
+
+	assert.Len(t, page.Notifications, 1)
+	assert.Equal(t, "http://testing-123.com/things/uuid2", page.Notifications[0].ID)
+	mockClient.AssertExpectations(t)
+}
+
+func TestReadNotificationsWithItemChanges(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	mockSince, _ := time.Parse(time.RFC3339Nano, "2006-01-02T15:04:05.99999Z")
+
+	req, _ := http.NewRequest("GET", "http://nothing/at/all?since=2006-01-02T15:04:05.99999Z&itemChanges=true&collapse=false", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockClient.On("GetLimit").Return(200)
+
+	mockNotifications := []model.InternalNotification{
+		{
+			UUID:         "uuid",
+			LastModified: time.Now(),
+			EventType:    "UPDATE",
+			AddedItems:   []string{"added"},
+			RemovedItems: []string{"removed"},
+			Reordered:    true,
+		},
+	}
+
+	mockClient.On("ReadNotifications", 0, 0, mockSince, model.NotificationFilter{Uncollapsed: true}).Return(&mockNotifications, nil)
+
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
+
+	assert.Equal(t, 200, w.Code)
+
+	page := model.PublicNotificationPage{}
+	err := json.NewDecoder(w.Body).Decode(&page)
+	assert.NoError(t, err)
+
+	assert.Len(t, page.Notifications, 1)
+	assert.Equal(t, []string{"added"}, page.Notifications[0].AddedItems)
+	assert.Equal(t, []string{"removed"}, page.Notifications[0].RemovedItems)
+	assert.True(t, *page.Notifications[0].Reordered)
+	assert.Contains(t, page.Links[0].Href, "itemChanges=true", "The next link should keep the opt-in")
+	mockClient.AssertExpectations(t)
+}
+
+func TestReadNotificationsWithoutItemChanges(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	mockSince, _ := time.Parse(time.RFC3339Nano, "2006-01-02T15:04:05.99999Z")
+
+	req, _ := http.NewRequest("GET", "http://nothing/at/all?since=2006-01-02T15:04:05.99999Z", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockClient.On("GetLimit").Return(200)
+
+	mockNotifications := []model.InternalNotification{
+		{
+			UUID:         "uuid",
+			LastModified: time.Now(),
+			EventType:    "UPDATE",
+			AddedItems:   []string{"added"},
+			Reordered:    true,
+		},
+	}
+
+	mockClient.On("ReadNotifications", 0, 0, mockSince, model.NotificationFilter{}).Return(&mockNotifications, nil)
+
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	assert.NotContains(t, w.Body.String(), "addedItems")
+	assert.NotContains(t, w.Body.String(), "reordered")
+	mockClient.AssertExpectations(t)
+}
+
+func TestReadNotificationsItemChangesRequireUncollapsed(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("GET", "http://nothing/at/all?since=2006-01-02T15:04:05.99999Z&itemChanges=true", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
+
+	assert.Equal(t, 400, w.Code, "Collapsed notifications would only show the item changes of the latest notification")
+	assert.Equal(t, "{\"message\":\"Item changes are only shown for every notification; please specify collapse=false with itemChanges.\"}\n", w.Body.String())
+}
+
+func TestInvalidItemChanges(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("GET", "http://nothing/at/all?since=2006-01-02T15:04:05.99999Z&itemChanges=maybe", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
+
+	assert.Equal(t, 400, w.Code)
+	assert.Equal(t, "{\"message\":\"Please specify a boolean itemChanges.\"}\n", w.Body.String())
+}
+
+func TestReadNotificationsWithListMetadata(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	mockSince, _ := time.Parse(time.RFC3339Nano, "2006-01-02T15:04:05.99999Z")
+
+	req, _ := http.NewRequest("GET", "http://nothing/at/all?since=2006-01-02T15:04:05.99999Z&listMetadata=true", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockClient.On("GetLimit").Return(200)
+
+	concept := &model.Concept{UUID: "3095386b-bb12-37af-bb7b-b84390937caf", PrefLabel: "Investing 2.0: Unlocking Yield"}
+	mockNotifications := []model.InternalNotification{
+		{
+			UUID:         "uuid",
+			LastModified: time.Now(),
+			EventType:    "UPDATE",
+			LayoutHint:   "Standard",
+			ListType:     "SpecialReports",
+			Concept:      concept,
+		},
+	}
+
+	mockClient.On("ReadNotifications", 0, 0, mockSince, model.NotificationFilter{}).Return(&mockNotifications, nil)
+
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
+
+	assert.Equal(t, 200, w.Code)
+
+	page := model.PublicNotificationPage{}
+	err := json.NewDecoder(w.Body).Decode(&page)
+	assert.NoError(t, err)
+
+	assert.Len(t, page.Notifications, 1)
+	assert.Equal(t, "Standard", page.Notifications[0].LayoutHint)
+	assert.Equal(t, "SpecialReports", page.Notifications[0].ListType)
+	assert.Equal(t, concept, page.Notifications[0].Concept)
+	assert.Contains(t, page.Links[0].Href, "listMetadata=true", "The next link should keep the opt-in")
+	mockClient.AssertExpectations(t)
+}
+
+func TestReadNotificationsWithoutListMetadata(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	mockSince, _ := time.Parse(time.RFC3339Nano, "2006-01-02T15:04:05.99999Z")
+
+	req, _ := http.NewRequest("GET", "http://nothing/at/all?since=2006-01-02T15:04:05.99999Z", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockClient.On("GetLimit").Return(200)
+
+	mockNotifications := []model.InternalNotification{
+		{
+			UUID:         "uuid",
+			LastModified: time.Now(),
+			EventType:    "UPDATE",
+			LayoutHint:   "Standard",
+			Concept:      &model.Concept{UUID: "3095386b-bb12-37af-bb7b-b84390937caf"},
+		},
+	}
+
+	mockClient.On("ReadNotifications", 0, 0, mockSince, model.NotificationFilter{}).Return(&mockNotifications, nil)
+
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	assert.NotContains(t, w.Body.String(), "layoutHint")
+	assert.NotContains(t, w.Body.String(), "concept")
+	mockClient.AssertExpectations(t)
+}
+
+func TestReadNotificationsWithCursor(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	cursorLink := mapping.CursorNextLink{ApiHost: "testing-123.com", CacheDelay: 10, MaxLimit: 1, Secret: []byte("secret")}
+
+	lastModified := time.Now().UTC().Add(-time.Hour)
+	first, _ := cursorLink.NextLink(lastModified, time.Time{}, 0, 0, []model.InternalNotification{{UUID: "uuid", LastModified: lastModified}}, nil)
+
+	req, _ := http.NewRequest("GET", first.Href, nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockClient.On("GetLimit").Return(1)
+
+	changeDate := lastModified.Add(time.Minute)
+	mockNotifications := []model.InternalNotification{
+		{UUID: "uuid2", Title: "title", LastModified: changeDate, EventType: "UPDATE", PublishReference: "tid_blah-blah-blah"},
+		{UUID: "uuid3", Title: "title", LastModified: changeDate, EventType: "UPDATE", PublishReference: "tid_blah-blah-blah"},
+	}
+	mockClient.On("ReadNotificationsAfter", lastModified, "uuid", "", 0, model.NotificationFilter{}).Return(&mockNotifications, nil)
+
+	ReadNotifications(testMapper, cursorLink, mockClient, nil, 10000, 10, log)(w, req)
+
+	assert.Equal(t, 200, w.Code)
+
+	page := model.PublicNotificationPage{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&page))
+	assert.Len(t, page.Notifications, 1)
+	assert.Equal(t, "http://testing-123.com/things/uuid2", page.Notifications[0].ID)
+
+	next, err := url.Parse(page.Links[0].Href)
+	assert.NoError(t, err)
+	cursor, err := cursorLink.ParseCursor(next.Query().Get(mapping.CursorParam))
+	assert.NoError(t, err)
+	assert.Equal(t, "uuid2", cursor.UUID)
+	assert.True(t, changeDate.Equal(cursor.LastModified))
+
+	mockClient.AssertExpectations(t)
+}
+
+func TestReadNotificationsWithInvalidCursor(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	cursorLink := mapping.CursorNextLink{ApiHost: "testing-123.com", CacheDelay: 10, MaxLimit: 1, Secret: []byte("secret")}
+
+	req, _ := http.NewRequest("GET", "http://nothing/at/all?cursor=i-am-not-a-cursor", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	ReadNotifications(testMapper, cursorLink, mockClient, nil, 10000, 10, log)(w, req)
+
+	assert.Equal(t, 400, w.Code)
+	assert.Equal(t, "{\"message\":\"Invalid cursor; please use the cursor from the next link of a previous page.\"}\n", w.Body.String())
+	mockClient.AssertExpectations(t)
+}
+
+func TestReadNotificationsWithCursorWhenNotEnabled(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("GET", "http://nothing/at/all?cursor=abc.def", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
+
+	assert.Equal(t, 400, w.Code)
+	assert.Equal(t, "{\"message\":\"Cursors are not supported; please use the since and offset parameters.\"}\n", w.Body.String())
+}
+
+func TestReadNotificationsFilteredByUUID(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	mockSince, _ := time.Parse(time.RFC3339Nano, "2006-01-02T15:04:05.99999Z")
+
+	req, _ := http.NewRequest("GET", "http://nothing/at/all?since=2006-01-02T15:04:05.99999Z&uuid=ef863741-709a-4062-a8f1-987c44db1db5&uuid=2f0ea3a0-cd1d-4a3d-8a5a-02f1a7c1b1d9", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockNotifications := make([]model.InternalNotification, 0)
+	filter := model.NotificationFilter{UUIDs: []string{"ef863741-709a-4062-a8f1-987c44db1db5", "2f0ea3a0-cd1d-4a3d-8a5a-02f1a7c1b1d9"}}
+	mockClient.On("ReadNotifications", 0, 0, mockSince, filter).Return(&mockNotifications, nil)
+
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
+
+	assert.Equal(t, 200, w.Code)
+
+	page := model.PublicNotificationPage{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&page))
+
+	next, err := url.Parse(page.Links[0].Href)
+	assert.NoError(t, err)
+	assert.Equal(t, filter.UUIDs, next.Query()["uuid"], "The uuid filter should be carried forward in the next link")
+
+	mockClient.AssertExpectations(t)
+}
+
+func TestPostReadNotificationsFilteredByUUID(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	mockSince, _ := time.Parse(time.RFC3339Nano, "2006-01-02T15:04:05.99999Z")
+
+	body := `{"uuids": ["2f0ea3a0-cd1d-4a3d-8a5a-02f1a7c1b1d9"]}`
+	req, _ := http.NewRequest("POST", "http://nothing/at/all?since=2006-01-02T15:04:05.99999Z&uuid=ef863741-709a-4062-a8f1-987c44db1db5", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockNotifications := make([]model.InternalNotification, 0)
+	filter := model.NotificationFilter{UUIDs: []string{"ef863741-709a-4062-a8f1-987c44db1db5", "2f0ea3a0-cd1d-4a3d-8a5a-02f1a7c1b1d9"}}
+	mockClient.On("ReadNotifications", 0, 0, mockSince, filter).Return(&mockNotifications, nil)
+
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
+
+	assert.Equal(t, 200, w.Code)
+
+	page := model.PublicNotificationPage{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&page))
+
+	next, err := url.Parse(page.Links[0].Href)
+	assert.NoError(t, err)
+	assert.Empty(t, next.Query()["uuid"], "The uuids should be carried forward in one token")
+
+	carried, err := mapping.DecodeUUIDs(next.Query().Get(mapping.UUIDsParam))
+	assert.NoError(t, err)
+	assert.Equal(t, filter.UUIDs, carried, "Every uuid, including those in the body, should be carried forward in the next link")
+
+	mockClient.AssertExpectations(t)
+}
+
+func postUUIDs(count int) *http.Request {
+	uuids := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		uuids = append(uuids, fmt.Sprintf("%08x-cd1d-4a3d-8a5a-%012x", i, i))
+	}
+	body, _ := json.Marshal(map[string][]string{"uuids": uuids})
+	req, _ := http.NewRequest("POST", "http://nothing/at/all?since=2006-01-02T15:04:05.99999Z&type=UPDATE&collapse=false", bytes.NewReader(body))
+	return req
+}
+
+func TestPostReadNotificationsAtTheUUIDsCap(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockNotifications := make([]model.InternalNotification, 0)
+	mockClient.On("ReadNotifications", 0, 0, mock.Anything, mock.MatchedBy(func(filter model.NotificationFilter) bool {
+		return len(filter.UUIDs) == maxUUIDFilters
+	})).Return(&mockNotifications, nil)
+
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, postUUIDs(maxUUIDFilters))
+
+	assert.Equal(t, 200, w.Code)
+
+	page := model.PublicNotificationPage{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&page))
+	assert.LessOrEqual(t, len(page.Links[0].Href), 8192, "The next link should fit in a url")
+
+	next, err := url.Parse(page.Links[0].Href)
+	assert.NoError(t, err)
+	carried, err := mapping.DecodeUUIDs(next.Query().Get(mapping.UUIDsParam))
+	assert.NoError(t, err)
+	assert.Len(t, carried, maxUUIDFilters)
+
+	mockClient.AssertExpectations(t)
+}
+
+func TestPostReadNotificationsOverTheUUIDsCap(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, postUUIDs(maxUUIDFilters+1))
+
+	assert.Equal(t, 400, w.Code)
+	assert.Equal(t, "{\"message\":\"Please specify up to 300 valid list uuids.\"}\n", w.Body.String())
+	mockClient.AssertExpectations(t)
+}
+
+func TestReadNotificationsFollowsCarriedUUIDs(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	mockSince, _ := time.Parse(time.RFC3339Nano, "2006-01-02T15:04:05.99999Z")
+
+	uuids := []string{"ef863741-709a-4062-a8f1-987c44db1db5", "2f0ea3a0-cd1d-4a3d-8a5a-02f1a7c1b1d9"}
+	token, _ := mapping.EncodeUUIDs(uuids)
+	req, _ := http.NewRequest("GET", "http://nothing/at/all?since=2006-01-02T15:04:05.99999Z&uuids="+token, nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockNotifications := make([]model.InternalNotification, 0)
+	mockClient.On("ReadNotifications", 0, 0, mockSince, model.NotificationFilter{UUIDs: uuids}).Return(&mockNotifications, nil)
+
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
+
+	assert.Equal(t, 200, w.Code)
+
+	page := model.PublicNotificationPage{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&page))
+
+	next, err := url.Parse(page.Links[0].Href)
+	assert.NoError(t, err)
+	assert.Equal(t, token, next.Query().Get(mapping.UUIDsParam), "The uuids token should be carried forward again")
+
+	mockClient.AssertExpectations(t)
+}
+
+func TestReadNotificationsInvalidUUIDsToken(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("GET", "http://nothing/at/all?since=2006-01-02T15:04:05.99999Z&uuids=c2hvcnQ", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
+
+	assert.Equal(t, 400, w.Code)
+	mockClient.AssertExpectations(t)
+}
+
+func TestReadNotificationsInvalidUUIDFilter(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("GET", "http://nothing/at/all?since=2006-01-02T15:04:05.99999Z&uuid=not-a-uuid", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
+
+	assert.Equal(t, 400, w.Code)
+	assert.Equal(t, "{\"message\":\"Please specify up to 300 valid list uuids.\"}\n", w.Body.String())
+	mockClient.AssertExpectations(t)
+}
+
+func TestReadNotificationsFilteredByEventType(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	mockSince, _ := time.Parse(time.RFC3339Nano, "2006-01-02T15:04:05.99999Z")
+
+	req, _ := http.NewRequest("GET", "http://nothing/at/all?since=2006-01-02T15:04:05.99999Z&type=DELETE", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+
+	mockNotifications := make([]model.InternalNotification, 0)
+	filter := model.NotificationFilter{EventTypes: []string{"DELETE", "http://www.ft.com/thing/ThingChangeType/DELETE"}}
+	mockClient.On("ReadNotifications", 0, 0, mockSince, filter).Return(&mockNotifications, nil)
+
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
+
+	assert.Equal(t, 200, w.Code)
+
+	page := model.PublicNotificationPage{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&page))
+
+	next, err := url.Parse(page.Links[0].Href)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"DELETE"}, next.Query()["type"], "The type filter should be carried forward in the next link")
+
+	mockClient.AssertExpectations(t)
+}
+
+func TestReadNotificationsUnknownEventType(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("GET", "http://nothing/at/all?since=2006-01-02T15:04:05.99999Z&type=PUBLISH", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
+
+	assert.Equal(t, 400, w.Code)
+	assert.Equal(t, "{\"message\":\"Please specify a known event type (CREATE, UPDATE, DELETE).\"}\n", w.Body.String())
+	mockClient.AssertExpectations(t)
+}
+
+func TestReadNotificationsLastPageOfBoundedWindow(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	mockSince, _ := time.Parse(time.RFC3339Nano, "2006-01-02T09:00:00Z")
+	mockUntil, _ := time.Parse(time.RFC3339Nano, "2006-01-02T10:00:00Z")
+
+	req, _ := http.NewRequest("GET", "http://nothing/at/all?since=2006-01-02T09:00:00Z&until=2006-01-02T10:00:00Z", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockClient.On("GetLimit").Return(200)
+
+	mockNotifications := []model.InternalNotification{
+		{UUID: "uuid", Title: "title", LastModified: mockSince.Add(time.Minute), EventType: "UPDATE", PublishReference: "tid_blah-blah-blah"},
+	}
+	mockClient.On("ReadNotifications", 0, 0, mockSince, model.NotificationFilter{Until: mockUntil}).Return(&mockNotifications, nil)
+
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
+
+	assert.Equal(t, 200, w.Code)
+
+	page := model.PublicNotificationPage{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&page))
+	assert.Len(t, page.Notifications, 1)
+	assert.True(t, page.LastPage, "The page should say there are no more pages")
+	assert.NotNil(t, page.Links)
+	assert.Empty(t, page.Links, "There should be no next link")
+
+	mockClient.AssertExpectations(t)
+}
+
+func TestReadNotificationsUntilBeforeSince(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("GET", "http://nothing/at/all?since=2006-01-02T09:00:00Z&until=2006-01-02T09:00:00Z", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
+
+	assert.Equal(t, 400, w.Code)
+	assert.Equal(t, "{\"message\":\"Until date must be after the since date.\"}\n", w.Body.String())
+	mockClient.AssertExpectations(t)
+}
+
+func TestReadNotificationsJunkUntil(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("GET", "http://nothing/at/all?since=2006-01-02T09:00:00Z&until=tomorrow", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
+
+	assert.Equal(t, 400, w.Code)
+	assert.Equal(t, "{\"message\":\"Please specify an RFC3339 until date.\"}\n", w.Body.String())
+}
+
+func TestReadNotificationsWithLimit(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	mockSince, _ := time.Parse(time.RFC3339Nano, "2006-01-02T15:04:05.99999Z")
+
+	req, _ := http.NewRequest("GET", "http://nothing/at/all?since=2006-01-02T15:04:05.99999Z&limit=1", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockClient.On("GetLimit").Return(200)
+
+	changeDate := time.Now()
+	mockNotifications := []model.InternalNotification{
+		{UUID: "uuid", Title: "title", LastModified: changeDate, EventType: "UPDATE", PublishReference: "tid_blah-blah-blah"},
+		{UUID: "uuid2", Title: "title", LastModified: changeDate.Add(time.Second), EventType: "UPDATE", PublishReference: "tid_blah-blah-blah"},
+	}
+	mockClient.On("ReadNotifications", 0, 1, mockSince, model.NotificationFilter{}).Return(&mockNotifications, nil)
+
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
+
+	assert.Equal(t, 200, w.Code)
+
+	page := model.PublicNotificationPage{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&page))
+	assert.Len(t, page.Notifications, 1, "The page should be the size of the requested limit")
+
+	next, err := url.Parse(page.Links[0].Href)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", next.Query().Get("limit"), "The limit should be carried forward in the next link")
+	assert.Equal(t, changeDate.UTC().Add(10*time.Second).Format(time.RFC3339Nano), next.Query().Get("since"))
+
+	mockClient.AssertExpectations(t)
+}
+
+func TestReadNotificationsLimitIsCapped(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	mockSince, _ := time.Parse(time.RFC3339Nano, "2006-01-02T15:04:05.99999Z")
+
+	req, _ := http.NewRequest("GET", "http://nothing/at/all?since=2006-01-02T15:04:05.99999Z&limit=5000", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockClient.On("GetLimit").Return(200)
+
+	mockNotifications := make([]model.InternalNotification, 0)
+	mockClient.On("ReadNotifications", 0, 200, mockSince, model.NotificationFilter{}).Return(&mockNotifications, nil)
+
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
+
+	assert.Equal(t, 200, w.Code)
+
+	page := model.PublicNotificationPage{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&page))
+
+	next, err := url.Parse(page.Links[0].Href)
+	assert.NoError(t, err)
+	assert.Equal(t, "200", next.Query().Get("limit"))
+
+	mockClient.AssertExpectations(t)
+}
+
+func TestReadNotificationsInvalidLimit(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+
+	for _, limit := range []string{"0", "-5", "lots"} {
+		req, _ := http.NewRequest("GET", "http://nothing/at/all?since=2006-01-02T15:04:05.99999Z&limit="+limit, nil)
+		w := httptest.NewRecorder()
+
+		mockClient := new(MockClient)
+		ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
+
+		assert.Equal(t, 400, w.Code, limit)
+		assert.Equal(t, "{\"message\":\"Please specify a positive integer limit.\"}\n", w.Body.String())
+	}
+}
+
+func TestReadNotificationsWaitsForNotifications(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	mockSince, _ := time.Parse(time.RFC3339Nano, "2006-01-02T15:04:05.99999Z")
+	notifier := NewNotifier(0)
+
+	req, _ := http.NewRequest("GET", "http://nothing/at/all?since=2006-01-02T15:04:05.99999Z&wait=10s", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockClient.On("GetLimit").Return(200)
+
+	empty := make([]model.InternalNotification, 0)
+	mockNotifications := []model.InternalNotification{
+		{UUID: "uuid", Title: "title", LastModified: time.Now(), EventType: "UPDATE", PublishReference: "tid_blah-blah-blah"},
+	}
+	mockClient.On("ReadNotifications", 0, 0, mockSince, model.NotificationFilter{}).Return(&empty, nil).Once()
+	mockClient.On("ReadNotifications", 0, 0, mockSince, model.NotificationFilter{}).Return(&mockNotifications, nil).Once()
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		notifier.Notify()
+	}()
+
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, notifier, 10000, 10, log)(w, req)
+
+	assert.Equal(t, 200, w.Code)
+
+	page := model.PublicNotificationPage{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&page))
+	assert.Len(t, page.Notifications, 1, "The notification written while waiting should be returned")
+
+	next, err := url.Parse(page.Links[0].Href)
+	assert.NoError(t, err)
+	assert.Equal(t, "10s", next.Query().Get("wait"), "The wait should be carried forward in the next link")
+
+	mockClient.AssertExpectations(t)
+}
+
+func TestReadNotificationsInvalidWait(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+
+	for _, wait := range []string{"forever", "-1s", "5m"} {
+		req, _ := http.NewRequest("GET", "http://nothing/at/all?since=2006-01-02T15:04:05.99999Z&wait="+wait, nil)
+		w := httptest.NewRecorder()
+
+		mockClient := new(MockClient)
+		ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
+
+		assert.Equal(t, 400, w.Code, wait)
+		assert.Equal(t, "{\"message\":\"Please specify a wait duration of up to 30s, e.g. wait=30s.\"}\n", w.Body.String())
+	}
+}
+
+func TestReadNotificationsUncollapsed(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	mockSince, _ := time.Parse(time.RFC3339Nano, "2006-01-02T15:04:05.99999Z")
+
+	req, _ := http.NewRequest("GET", "http://nothing/at/all?since=2006-01-02T15:04:05.99999Z&collapse=false", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockClient.On("GetLimit").Return(200)
+
+	changeDate := time.Now()
+	mockNotifications := []model.InternalNotification{
+		{UUID: "uuid", Title: "title", LastModified: changeDate, EventType: "UPDATE", PublishReference: "tid_1"},
+		{UUID: "uuid", Title: "title", LastModified: changeDate.Add(time.Second), EventType: "UPDATE", PublishReference: "tid_2"},
+	}
+	mockClient.On("ReadNotifications", 0, 0, mockSince, model.NotificationFilter{Uncollapsed: true}).Return(&mockNotifications, nil)
+
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	mockClient.AssertExpectations(t)
+
+	page := model.PublicNotificationPage{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&page))
+	assert.Len(t, page.Notifications, 2, "Every notification for the list should be read")
+
+	next, err := url.Parse(page.Links[0].Href)
+	assert.NoError(t, err)
+	assert.Equal(t, "false", next.Query().Get("collapse"), "collapse should be carried forward in the next link")
+}
+
+func TestReadNotificationsJunkCollapse(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("GET", "http://nothing/at/all?since=2006-01-02T09:00:00Z&collapse=never", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
+
+	assert.Equal(t, 400, w.Code)
+	assert.Equal(t, "{\"message\":\"Please specify a boolean collapse.\"}\n", w.Body.String())
+}
+
+func TestReadNotificationsSinceEpochMillis(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("GET", "http://nothing/at/all?since=1136214245999", nil)
+	w := httptest.NewRecorder()
+
+	mockNotifications := make([]model.InternalNotification, 0)
+
+	mockClient := new(MockClient)
+	mockClient.On("ReadNotifications", 0, 0, time.Date(2006, 1, 2, 15, 4, 5, 999000000, time.UTC), model.NotificationFilter{}).Return(&mockNotifications, nil)
+
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	mockClient.AssertExpectations(t)
+}
+
+func TestReadNotificationsSinceNow(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("GET", "http://nothing/at/all?since=now&type=UPDATE", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+
+	before := time.Now().UTC()
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 10000, 10, log)(w, req)
+	after := time.Now().UTC()
+
+	assert.Equal(t, 200, w.Code)
+	mockClient.AssertNotCalled(t, "ReadNotifications", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	page := model.PublicNotificationPage{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&page))
+	assert.NotNil(t, page.Notifications)
+	assert.Empty(t, page.Notifications, "Nothing can be read from now yet")
+
+	require.Len(t, page.Links, 1)
+	next, err := url.Parse(page.Links[0].Href)
+	require.NoError(t, err)
+	assert.Equal(t, "UPDATE", next.Query().Get("type"))
+
+	since, err := time.Parse(time.RFC3339Nano, next.Query().Get("since"))
+	require.NoError(t, err)
+	assert.False(t, since.Before(before) || since.After(after), "The next link should read the notifications which become readable from now on")
+}
+
+func TestReadNotificationsClampsSinceDate(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("GET", "http://nothing/at/all?since=2006-01-02T15:04:05.999Z&clamp=true&type=DELETE", nil)
+	w := httptest.NewRecorder()
+
+	requested := time.Date(2006, 1, 2, 15, 4, 5, 999000000, time.UTC)
+	earliest := time.Now().UTC().AddDate(0, 0, -90)
+	isEarliest := mock.MatchedBy(func(since time.Time) bool {
+		return !since.Before(earliest) && since.Before(earliest.Add(time.Minute))
+	})
+	filter := model.NotificationFilter{EventTypes: []string{"DELETE", "http://www.ft.com/thing/ThingChangeType/DELETE"}}
+
+	mockNotifications := make([]model.InternalNotification, 0)
+
+	mockClient := new(MockClient)
+	mockClient.On("CountNotificationsBetween", requested, isEarliest, filter).Return(int64(42), nil)
+	mockClient.On("ReadNotifications", 0, 0, isEarliest, filter).Return(&mockNotifications, nil)
+
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 90, 10, log)(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	mockClient.AssertExpectations(t)
+	assert.Equal(t, "true", w.Header().Get("X-Since-Truncated"))
+	assert.Equal(t, "42", w.Header().Get("X-Notifications-Missed"))
+
+	page := model.PublicNotificationPage{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&page))
+	require.NotNil(t, page.Truncated)
+	assert.Equal(t, requested, page.Truncated.RequestedSince)
+	assert.False(t, page.Truncated.Since.Before(earliest))
+	assert.Equal(t, int64(42), page.Truncated.Missed)
+
+	require.Len(t, page.Links, 1)
+	next, err := url.Parse(page.Links[0].Href)
+	require.NoError(t, err)
+	assert.Equal(t, "true", next.Query().Get("clamp"), "clamp should be carried forward in the next link")
+}
+
+func TestReadNotificationsClampDoesNotTruncateRecentSinceDate(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	since := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	req, _ := http.NewRequest("GET", "http://nothing/at/all?clamp=true&since="+since.Format(time.RFC3339), nil)
+	w := httptest.NewRecorder()
+
+	mockNotifications := make([]model.InternalNotification, 0)
+
+	mockClient := new(MockClient)
+	mockClient.On("ReadNotifications", 0, 0, since, model.NotificationFilter{}).Return(&mockNotifications, nil)
+
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 90, 10, log)(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	mockClient.AssertExpectations(t)
+	assert.Empty(t, w.Header().Get("X-Since-Truncated"))
+	assert.NotContains(t, w.Body.String(), "truncated")
+}
+
+func TestReadNotificationsFailsToCountMissedNotifications(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("GET", "http://nothing/at/all?since=2006-01-02T15:04:05.999Z&clamp=true", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockClient.On("CountNotificationsBetween", mock.Anything, mock.Anything, model.NotificationFilter{}).Return(int64(0), errors.New("no db"))
+
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 90, 10, log)(w, req)
+
+	assert.Equal(t, 500, w.Code)
+	mockClient.AssertExpectations(t)
+}
+
+func TestReadNotificationsJunkClamp(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("GET", "http://nothing/at/all?since=2006-01-02T15:04:05.999Z&clamp=please", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	ReadNotifications(testMapper, testLinkGenerator, mockClient, nil, 90, 10, log)(w, req)
+
+	assert.Equal(t, 400, w.Code)
+	assert.Equal(t, "{\"message\":\"Please specify a boolean clamp.\"}\n", w.Body.String())
+}
@@ -0,0 +1,104 @@
+package resources
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sinceNow is the since parameter which starts reading from the latest notifications
+const sinceNow = "now"
+
+// epochMillisThreshold is the smallest since parameter which is read as epoch millis rather than seconds; as seconds, it
+// would be in the year 5138
+const epochMillisThreshold = 100000000000
+
+var epochPattern = regexp.MustCompile(`^\d+$`)
+
+// durationPattern matches an ISO-8601 duration, such as P1DT12H, optionally preceded by a minus sign
+var durationPattern = regexp.MustCompile(`^-?P(?:(\d+)Y)?(?:(\d+)M)?(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:[.,]\d+)?)S)?)?$`)
+
+// parseSince parses the since parameter, which may be:
+//   - now, for the latest notifications
+//   - an RFC3339 date, with or without fractional seconds and in any offset
+//   - epoch seconds or millis
+//   - an ISO-8601 duration before now, such as -PT1H (the minus sign is optional, as since is always in the past)
+func parseSince(param string, now time.Time) (time.Time, error) {
+	switch {
+	case strings.EqualFold(param, sinceNow):
+		return now.UTC(), nil
+	case epochPattern.MatchString(param):
+		return parseEpoch(param)
+	case durationPattern.MatchString(strings.ToUpper(param)):
+		return parseRelative(strings.ToUpper(param), now)
+	}
+
+	since, err := time.Parse(time.RFC3339Nano, normalizeRFC3339(param))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return since.UTC(), nil
+}
+
+func parseEpoch(param string) (time.Time, error) {
+	epoch, err := strconv.ParseInt(param, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if epoch >= epochMillisThreshold {
+		return time.UnixMilli(epoch).UTC(), nil
+	}
+	return time.Unix(epoch, 0).UTC(), nil
+}
+
+func parseRelative(param string, now time.Time) (time.Time, error) {
+	if strings.TrimLeft(param, "-") == "P" || strings.HasSuffix(param, "T") {
+		return time.Time{}, fmt.Errorf("duration %v has no components", param)
+	}
+
+	parts := durationPattern.FindStringSubmatch(param)
+	var values [6]int
+	for i, part := range parts[1:7] {
+		if part == "" {
+			continue
+		}
+		value, err := strconv.Atoi(part)
+		if err != nil {
+			return time.Time{}, err
+		}
+		values[i] = value
+	}
+
+	seconds := 0.0
+	if parts[7] != "" {
+		var err error
+		if seconds, err = strconv.ParseFloat(strings.Replace(parts[7], ",", ".", 1), 64); err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	years, months, weeks, days, hours, minutes := values[0], values[1], values[2], values[3], values[4], values[5]
+	clock := time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(math.Round(seconds*float64(time.Second)))
+	if clock < 0 {
+		return time.Time{}, errors.New("duration is too long")
+	}
+
+	return now.UTC().AddDate(-years, -months, -7*weeks-days).Add(-clock), nil
+}
+
+// normalizeRFC3339 undoes the changes an RFC3339 date may suffer in a query string, and allows the lower case and
+// space separated forms which RFC3339 permits. A '+' offset which has not been escaped is decoded as a space.
+func normalizeRFC3339(param string) string {
+	date := []byte(strings.ToUpper(param))
+	if len(date) > 10 && date[10] == ' ' {
+		date[10] = 'T'
+	}
+	if n := len(date); n > 6 && date[n-6] == ' ' && date[n-3] == ':' {
+		date[n-6] = '+'
+	}
+	return string(date)
+}
@@ -0,0 +1,47 @@
+package resources
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2017, 3, 15, 12, 0, 0, 0, time.UTC)
+
+	for param, expected := range map[string]time.Time{
+		"now":                            now,
+		"NOW":                            now,
+		"2017-03-01T12:51:00.123456789Z": time.Date(2017, 3, 1, 12, 51, 0, 123456789, time.UTC),
+		"2017-03-01T12:51:00Z":           time.Date(2017, 3, 1, 12, 51, 0, 0, time.UTC),
+		"2017-03-01T13:51:00+01:00":      time.Date(2017, 3, 1, 12, 51, 0, 0, time.UTC),
+		"2017-03-01T13:51:00 01:00":      time.Date(2017, 3, 1, 12, 51, 0, 0, time.UTC),
+		"2017-03-01T07:51:00.5-05:00":    time.Date(2017, 3, 1, 12, 51, 0, 500000000, time.UTC),
+		"2017-03-01 12:51:00z":           time.Date(2017, 3, 1, 12, 51, 0, 0, time.UTC),
+		"2017-03-01t12:51:00z":           time.Date(2017, 3, 1, 12, 51, 0, 0, time.UTC),
+		"1488372660":                     time.Date(2017, 3, 1, 12, 51, 0, 0, time.UTC),
+		"1488372660123":                  time.Date(2017, 3, 1, 12, 51, 0, 123000000, time.UTC),
+		"-PT1H":                          now.Add(-time.Hour),
+		"PT1H":                           now.Add(-time.Hour),
+		"-pt90m":                         now.Add(-90 * time.Minute),
+		"-PT0.5S":                        now.Add(-500 * time.Millisecond),
+		"-P1DT12H":                       now.Add(-36 * time.Hour),
+		"-P2W":                           now.AddDate(0, 0, -14),
+		"-P1M":                           time.Date(2017, 2, 15, 12, 0, 0, 0, time.UTC),
+		"-P1Y2M3DT4H5M6S":                time.Date(2016, 1, 12, 7, 54, 54, 0, time.UTC),
+	} {
+		since, err := parseSince(param, now)
+		require.NoError(t, err, param)
+		assert.True(t, expected.Equal(since), "%s: expected %v, got %v", param, expected, since)
+		assert.Equal(t, time.UTC, since.Location(), param)
+	}
+}
+
+func TestParseInvalidSince(t *testing.T) {
+	for _, param := range []string{"", "yesterday", "-P", "-PT", "-P1H", "PT1.5H", "-1488372660", "2017-03-01", "2017-03-01T12:51:00"} {
+		_, err := parseSince(param, time.Now())
+		assert.Error(t, err, param)
+	}
+}
@@ -0,0 +1,214 @@
+package resources
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/list-notifications-rw/mapping"
+	"github.com/Financial-Times/list-notifications-rw/model"
+	"github.com/rcrowley/go-metrics"
+)
+
+// streamFilter reads every notification, rather than collapsing them into the latest for each list. A collapsed read
+// would drop a notification already streamed once its list is republished, and so shift every position after it.
+var streamFilter = model.NotificationFilter{Uncollapsed: true}
+
+// openStreams counts the notification streams currently open on this instance
+var openStreams = metrics.GetOrRegisterCounter("list_notifications_open_streams", metrics.DefaultRegistry)
+
+// StreamConfig configures the notification streams.
+type StreamConfig struct {
+	MaxStreams       int           // The max number of concurrent streams on this instance.
+	MaxSinceInterval int           // The max number of days in the past a stream may start from.
+	CacheDelay       int           // The number of seconds before a written notification can be read.
+	Heartbeat        time.Duration // How often to send a comment to keep idle streams open.
+	PollInterval     time.Duration // How often to check the db for notifications written by other instances.
+	WriteTimeout     time.Duration // How long a client may take to receive each write before it is disconnected.
+}
+
+// StreamNotifications streams every notification, including each republish of a list, as a server-sent event as soon as it can be read. Each event id is the
+// since and offset query parameters which would read the notifications after it, and a reconnecting client's
+// Last-Event-ID header resumes the stream from that position. Without one, the stream starts from the since parameter.
+// The stream is pulled from the db a page at a time, so a slow client only holds up its own stream, and clients which
+// are too slow to receive a write are disconnected.
+func StreamNotifications(mapper mapping.NotificationsMapper, reader notificationReader, notifier *Notifier, config StreamConfig, log *logger.UPPLogger) func(w http.ResponseWriter, r *http.Request) {
+	slots := make(chan struct{}, config.MaxStreams)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		position, err := getStreamPosition(r, config)
+		if err != nil {
+			log.WithError(err).Info("User provided an invalid stream position.")
+			writeMessage(fmt.Sprintf("Please specify a since date within the last %d days, or the Last-Event-ID of a previous stream.", config.MaxSinceInterval), 400, w)
+			return
+		}
+
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+		default:
+			log.Warn("Rejecting notification stream; the max number of streams are already open.")
+			w.Header().Set("Retry-After", "30")
+			writeMessage("Too many notification streams are open, please retry later.", 503, w)
+			return
+		}
+
+		openStreams.Inc(1)
+		defer openStreams.Dec(1)
+
+		controller := http.NewResponseController(w)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(200)
+
+		logEntry := log.WithField("since", mapping.PositionParams(position).Encode())
+		logEntry.Info("Opened notification stream.")
+
+		stream := &notificationStream{
+			mapper:     mapper,
+			reader:     reader,
+			w:          w,
+			controller: controller,
+			timeout:    config.WriteTimeout,
+			cacheDelay: time.Duration(config.CacheDelay) * time.Second,
+			log:        logEntry,
+		}
+		err = stream.run(r, &position, notifier, config)
+		logEntry.WithError(err).Info("Closed notification stream.")
+	}
+}
+
+type notificationStream struct {
+	mapper     mapping.NotificationsMapper
+	reader     notificationReader
+	w          http.ResponseWriter
+	controller *http.ResponseController
+	timeout    time.Duration
+	cacheDelay time.Duration
+	log        *logger.LogEntry
+}
+
+func (s *notificationStream) run(r *http.Request, position *model.Position, notifier *Notifier, config StreamConfig) error {
+	if err := s.flush(); err != nil {
+		return err
+	}
+
+	heartbeat := time.NewTicker(config.Heartbeat)
+	defer heartbeat.Stop()
+
+	poll := time.NewTicker(config.PollInterval)
+	defer poll.Stop()
+
+	for {
+		more, err := s.sendPage(position)
+		if err != nil {
+			return err
+		}
+		if more {
+			continue
+		}
+
+	wait:
+		for {
+			select {
+			case <-r.Context().Done():
+				return r.Context().Err()
+			case <-heartbeat.C:
+				if err = s.write(": heartbeat\n\n"); err != nil {
+					return err
+				}
+			case <-notifier.Visible():
+				break wait
+			case <-poll.C:
+				break wait
+			}
+		}
+	}
+}
+
+// sendPage sends the next page of notifications after the position, and returns true if there are more to send.
+func (s *notificationStream) sendPage(position *model.Position) (bool, error) {
+	notifications, err := s.reader.ReadNotifications(position.Offset, 0, position.Since, streamFilter)
+	if err != nil {
+		s.log.WithError(err).Error("Failed to query database for notifications to stream!")
+		return false, err
+	}
+	if len(*notifications) == 0 {
+		return false, nil
+	}
+
+	limit := s.reader.GetLimit()
+	for i, n := range *notifications {
+		if i >= limit {
+			break
+		}
+		*position = mapping.AdvancePosition(*position, n, s.cacheDelay)
+
+		public, err := s.mapper.MapInternalNotificationToPublic(n)
+		if err != nil {
+			s.log.WithError(err).WithField("uuid", n.UUID).WithField("transaction_id", n.PublishReference).Warn("Skipping notification which cannot be mapped to the public format.")
+			continue
+		}
+
+		data, err := json.Marshal(public)
+		if err != nil {
+			return false, err
+		}
+
+		if err = s.write(fmt.Sprintf("id: %s\ndata: %s\n\n", mapping.PositionParams(*position).Encode(), data)); err != nil {
+			return false, err
+		}
+	}
+
+	return len(*notifications) > limit, nil
+}
+
+// write writes and flushes the message, disconnecting the client if it takes longer than the write timeout.
+func (s *notificationStream) write(message string) error {
+	err := s.controller.SetWriteDeadline(time.Now().Add(s.timeout))
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+
+	if _, err = s.w.Write([]byte(message)); err != nil {
+		return err
+	}
+	return s.flush()
+}
+
+func (s *notificationStream) flush() error {
+	return s.controller.Flush()
+}
+
+// getStreamPosition reads the position to start streaming from the Last-Event-ID header, or the since query parameter.
+func getStreamPosition(r *http.Request, config StreamConfig) (model.Position, error) {
+	query := r.URL.Query()
+	if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+		var err error
+		if query, err = url.ParseQuery(lastEventID); err != nil {
+			return model.Position{}, err
+		}
+	}
+
+	since, err := time.Parse(time.RFC3339Nano, query.Get("since"))
+	if err != nil {
+		return model.Position{}, err
+	}
+	if since.Before(time.Now().UTC().AddDate(0, 0, -config.MaxSinceInterval)) {
+		return model.Position{}, fmt.Errorf("since date %v is before the max since interval", since)
+	}
+
+	offset := 0
+	if param := query.Get("offset"); param != "" {
+		if offset, err = strconv.Atoi(param); err != nil {
+			return model.Position{}, err
+		}
+	}
+
+	return model.Position{Since: since, Offset: offset}, nil
+}
@@ -0,0 +1,151 @@
+package resources
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/list-notifications-rw/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var testStreamConfig = StreamConfig{
+	MaxStreams:       1,
+	MaxSinceInterval: 10000,
+	CacheDelay:       10,
+	Heartbeat:        20 * time.Millisecond,
+	PollInterval:     10 * time.Millisecond,
+	WriteTimeout:     time.Second,
+}
+
+func TestStreamNotifications(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	mockSince, _ := time.Parse(time.RFC3339Nano, "2006-01-02T15:04:05Z")
+	lastModified := mockSince.Add(time.Minute)
+
+	mockClient := new(MockClient)
+	mockClient.On("GetLimit").Return(200)
+
+	mockNotifications := []model.InternalNotification{
+		{UUID: "uuid", Title: "title", LastModified: lastModified, EventType: "UPDATE", PublishReference: "tid_blah-blah-blah"},
+		{UUID: "uuid2", Title: "title", LastModified: lastModified, EventType: "UPDATE", PublishReference: "tid_blah-blah-blah"},
+	}
+	empty := make([]model.InternalNotification, 0)
+	mockClient.On("ReadNotifications", 0, 0, mockSince, streamFilter).Return(&mockNotifications, nil).Once()
+	mockClient.On("ReadNotifications", 2, 0, lastModified.Add(10*time.Second), streamFilter).Return(&empty, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", "http://nothing/lists/notifications/stream?since=2006-01-02T15:04:05Z", nil)
+	w := httptest.NewRecorder()
+
+	StreamNotifications(testMapper, mockClient, nil, testStreamConfig, log)(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+
+	body := w.Body.String()
+	assert.Contains(t, body, "id: offset=1&since=2006-01-02T15%3A05%3A15Z\ndata: {\"type\":\"http://www.ft.com/thing/ThingChangeType/UPDATE\",\"id\":\"http://testing-123.com/things/uuid\"")
+	assert.Contains(t, body, "id: offset=2&since=2006-01-02T15%3A05%3A15Z\ndata: {\"type\":\"http://www.ft.com/thing/ThingChangeType/UPDATE\",\"id\":\"http://testing-123.com/things/uuid2\"")
+	assert.Contains(t, body, ": heartbeat\n\n")
+
+	mockClient.AssertExpectations(t)
+}
+
+func TestStreamNotificationsRepublishedBetweenPolls(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	mockSince, _ := time.Parse(time.RFC3339Nano, "2006-01-02T15:04:05Z")
+	firstPublish := mockSince.Add(time.Minute)
+	republish := firstPublish.Add(time.Second)
+
+	mockClient := new(MockClient)
+	mockClient.On("GetLimit").Return(200)
+
+	first := []model.InternalNotification{
+		{UUID: "uuid", Title: "title", LastModified: firstPublish, EventType: "UPDATE", PublishReference: "tid_first"},
+	}
+	// the first publish is still read, and skipped by the offset, as the stream does not collapse the list's notifications
+	second := []model.InternalNotification{
+		{UUID: "uuid", Title: "title", LastModified: republish, EventType: "UPDATE", PublishReference: "tid_republish"},
+		{UUID: "uuid2", Title: "title", LastModified: republish, EventType: "UPDATE", PublishReference: "tid_other"},
+	}
+	empty := make([]model.InternalNotification, 0)
+	mockClient.On("ReadNotifications", 0, 0, mockSince, streamFilter).Return(&first, nil).Once()
+	mockClient.On("ReadNotifications", 1, 0, firstPublish.Add(10*time.Second), streamFilter).Return(&empty, nil).Once()
+	mockClient.On("ReadNotifications", 1, 0, firstPublish.Add(10*time.Second), streamFilter).Return(&second, nil).Once()
+	mockClient.On("ReadNotifications", 2, 0, republish.Add(10*time.Second), streamFilter).Return(&empty, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", "http://nothing/lists/notifications/stream?since=2006-01-02T15:04:05Z", nil)
+	w := httptest.NewRecorder()
+
+	StreamNotifications(testMapper, mockClient, nil, testStreamConfig, log)(w, req)
+
+	body := w.Body.String()
+	assert.Contains(t, body, `"publishReference":"tid_first"`)
+	assert.Contains(t, body, `"publishReference":"tid_republish"`, "The republish should be streamed")
+	assert.Contains(t, body, `"publishReference":"tid_other"`, "The other list at the same date should not be skipped")
+
+	mockClient.AssertExpectations(t)
+}
+
+func TestStreamNotificationsResumesFromLastEventID(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	mockSince, _ := time.Parse(time.RFC3339Nano, "2006-01-02T15:05:15Z")
+
+	mockClient := new(MockClient)
+	empty := make([]model.InternalNotification, 0)
+	mockClient.On("ReadNotifications", 2, 0, mockSince, streamFilter).Return(&empty, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", "http://nothing/lists/notifications/stream?since=2006-01-02T15:04:05Z", nil)
+	req.Header.Set("Last-Event-ID", "offset=2&since=2006-01-02T15%3A05%3A15Z")
+	w := httptest.NewRecorder()
+
+	StreamNotifications(testMapper, mockClient, nil, testStreamConfig, log)(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	mockClient.AssertExpectations(t)
+	mockClient.AssertNotCalled(t, "ReadNotifications", 0, 0, mock.Anything, mock.Anything)
+}
+
+func TestStreamNotificationsInvalidSince(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+
+	for _, since := range []string{"", "since=some-garbage-date", "since=2006-01-02T15:04:05Z"} {
+		req, _ := http.NewRequest("GET", "http://nothing/lists/notifications/stream?"+since, nil)
+		w := httptest.NewRecorder()
+
+		config := testStreamConfig
+		config.MaxSinceInterval = 90
+		StreamNotifications(testMapper, new(MockClient), nil, config, log)(w, req)
+
+		assert.Equal(t, 400, w.Code, since)
+		assert.True(t, strings.HasPrefix(w.Body.String(), "{\"message\":\"Please specify a since date within the last 90 days"))
+	}
+}
+
+func TestStreamNotificationsTooManyStreams(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+
+	req, _ := http.NewRequest("GET", "http://nothing/lists/notifications/stream?since=2006-01-02T15:04:05Z", nil)
+	w := httptest.NewRecorder()
+
+	config := testStreamConfig
+	config.MaxStreams = 0
+	StreamNotifications(testMapper, new(MockClient), nil, config, log)(w, req)
+
+	assert.Equal(t, 503, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	assert.Equal(t, "{\"message\":\"Too many notification streams are open, please retry later.\"}\n", w.Body.String())
+}
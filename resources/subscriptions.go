@@ -0,0 +1,230 @@
+package resources
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/list-notifications-rw/mapping"
+	"github.com/Financial-Times/list-notifications-rw/model"
+	"github.com/Financial-Times/list-notifications-rw/webhook"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// subscriptionsPath is where webhook subscriptions are managed. Like the other /__ paths, it is not exposed publicly,
+// so only services inside the cluster can read subscriptions or change where notifications are delivered.
+const subscriptionsPath = "/__subscriptions"
+
+type subscriptionStore interface {
+	CreateSubscription(subscription model.Subscription) error
+	ReadSubscriptions() ([]model.Subscription, error)
+	FindSubscription(id string) (model.Subscription, error)
+	UpdateSubscription(subscription model.Subscription) error
+	DeleteSubscription(id string) error
+}
+
+// subscriptionRequest is the body of requests to create or update a webhook subscription
+type subscriptionRequest struct {
+	CallbackURL string   `json:"callbackUrl"`
+	Secret      string   `json:"secret"`
+	UUIDs       []string `json:"uuids"`
+	Types       []string `json:"types"`
+}
+
+// CreateSubscription creates a webhook subscription, which is sent every notification written from now on which matches
+// its uuids and types. If no secret is given, one is generated; either way, the secret is only returned by this request.
+func CreateSubscription(store subscriptionStore, cacheDelay int, log *logger.UPPLogger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		subscription, ok := decodeSubscription(r, log, w)
+		if !ok {
+			return
+		}
+
+		var err error
+		if subscription.ID, err = randomHex(16); err == nil && subscription.Secret == "" {
+			subscription.Secret, err = randomHex(32)
+		}
+		if err != nil {
+			log.WithError(err).Error("Failed to generate webhook subscription id or secret")
+			writeMessage("Failed to create subscription.", 500, w)
+			return
+		}
+
+		now := time.Now().UTC()
+		subscription.CreatedAt = now
+		subscription.Delivery.Position = model.Position{Since: now.Add(time.Duration(cacheDelay) * time.Second)}
+
+		if err = store.CreateSubscription(subscription); err != nil {
+			log.WithError(err).Error("Failed to create webhook subscription")
+			writeMessage("Failed to create subscription.", 500, w)
+			return
+		}
+
+		log.WithField("subscription", subscription.ID).WithField("callbackUrl", subscription.CallbackURL).Info("Created webhook subscription.")
+		w.Header().Set("Location", subscriptionsPath+"/"+subscription.ID)
+		writeSubscription(subscription, 201, w, log)
+	}
+}
+
+// ReadSubscriptions lists every webhook subscription, without their secrets.
+func ReadSubscriptions(store subscriptionStore, log *logger.UPPLogger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		subscriptions, err := store.ReadSubscriptions()
+		if err != nil {
+			log.WithError(err).Error("Failed to read webhook subscriptions")
+			writeMessage("Failed to read subscriptions.", 500, w)
+			return
+		}
+
+		for i := range subscriptions {
+			subscriptions[i].Secret = ""
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		if err = json.NewEncoder(w).Encode(subscriptions); err != nil {
+			log.WithError(err).Error("Failed to encode subscriptions")
+		}
+	}
+}
+
+// ReadSubscription reads the webhook subscription, without its secret.
+func ReadSubscription(store subscriptionStore, log *logger.UPPLogger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		logEntry := log.WithField("subscription", id)
+
+		subscription, err := store.FindSubscription(id)
+		if err != nil {
+			writeSubscriptionError(err, "Failed to read subscription.", logEntry, w)
+			return
+		}
+
+		subscription.Secret = ""
+		writeSubscription(subscription, 200, w, log)
+	}
+}
+
+// UpdateSubscription replaces the callback url, uuids and types of the webhook subscription. Its secret is only replaced
+// if a new one is given. Notifications continue to be delivered from where the subscription had got to.
+func UpdateSubscription(store subscriptionStore, log *logger.UPPLogger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		logEntry := log.WithField("subscription", id)
+
+		subscription, ok := decodeSubscription(r, log, w)
+		if !ok {
+			return
+		}
+		subscription.ID = id
+
+		if err := store.UpdateSubscription(subscription); err != nil {
+			writeSubscriptionError(err, "Failed to update subscription.", logEntry, w)
+			return
+		}
+
+		updated, err := store.FindSubscription(id)
+		if err != nil {
+			writeSubscriptionError(err, "Failed to read subscription.", logEntry, w)
+			return
+		}
+
+		logEntry.WithField("callbackUrl", updated.CallbackURL).Info("Updated webhook subscription.")
+		updated.Secret = ""
+		writeSubscription(updated, 200, w, log)
+	}
+}
+
+// DeleteSubscription removes the webhook subscription; no further notifications are delivered to it.
+func DeleteSubscription(store subscriptionStore, log *logger.UPPLogger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		logEntry := log.WithField("subscription", id)
+
+		if err := store.DeleteSubscription(id); err != nil {
+			writeSubscriptionError(err, "Failed to delete subscription.", logEntry, w)
+			return
+		}
+
+		logEntry.Info("Deleted webhook subscription.")
+		w.WriteHeader(204)
+	}
+}
+
+// decodeSubscription reads and validates the subscription in the request body, and responds to the request if it is invalid.
+func decodeSubscription(r *http.Request, log *logger.UPPLogger, w http.ResponseWriter) (model.Subscription, bool) {
+	var body subscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		log.WithError(err).Info("Failed to decode webhook subscription request.")
+		writeMessage("Invalid Request body.", 400, w)
+		return model.Subscription{}, false
+	}
+
+	if err := validateSubscription(body); err != nil {
+		log.WithError(err).Info("User provided an invalid webhook subscription.")
+		writeMessage(fmt.Sprintf("Invalid subscription: %v.", err), 400, w)
+		return model.Subscription{}, false
+	}
+
+	return model.Subscription{
+		CallbackURL: body.CallbackURL,
+		Secret:      body.Secret,
+		UUIDs:       body.UUIDs,
+		Types:       body.Types,
+	}, true
+}
+
+func validateSubscription(body subscriptionRequest) error {
+	err := webhook.ValidateCallbackURL(body.CallbackURL)
+	if err != nil {
+		return err
+	}
+
+	if len(body.UUIDs) > maxUUIDFilters {
+		return fmt.Errorf("specify up to %d uuids", maxUUIDFilters)
+	}
+	for _, uuid := range body.UUIDs {
+		if !mapping.IsUUID(uuid) {
+			return fmt.Errorf("%q is not a valid uuid", uuid)
+		}
+	}
+
+	for _, eventType := range body.Types {
+		if _, err = mapping.StoredEventTypes(eventType); err != nil {
+			return fmt.Errorf("%q is not a known event type (CREATE, UPDATE, DELETE)", eventType)
+		}
+	}
+	return nil
+}
+
+func writeSubscription(subscription model.Subscription, status int, w http.ResponseWriter, log *logger.UPPLogger) {
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(subscription); err != nil {
+		log.WithError(err).Error("Failed to encode subscription")
+	}
+}
+
+func writeSubscriptionError(err error, message string, logEntry *logger.LogEntry, w http.ResponseWriter) {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		writeMessage("Subscription not found.", 404, w)
+		return
+	}
+
+	logEntry.WithError(err).Error(message)
+	writeMessage(message, 500, w)
+}
+
+func randomHex(bytes int) (string, error) {
+	b := make([]byte, bytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,186 @@
+package resources
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/list-notifications-rw/model"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func SubscriptionRoute(handler func(w http.ResponseWriter, r *http.Request)) *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc(subscriptionsPath, handler)
+	r.HandleFunc(subscriptionsPath+"/{id}", handler)
+	return r
+}
+
+func TestCreateSubscription(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	body := `{"callbackUrl":"https://example.com/hook","uuids":["ef863741-709a-4062-a8f1-987c44db1db5"],"types":["update"]}`
+	req, _ := http.NewRequest("POST", "http://our.host.name/__subscriptions", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	before := time.Now().UTC()
+	mockClient := new(MockClient)
+	mockClient.On("CreateSubscription", mock.MatchedBy(func(s model.Subscription) bool {
+		return s.ID != "" && len(s.Secret) == 64 &&
+			s.CallbackURL == "https://example.com/hook" &&
+			assert.ObjectsAreEqual([]string{"ef863741-709a-4062-a8f1-987c44db1db5"}, s.UUIDs) &&
+			assert.ObjectsAreEqual([]string{"update"}, s.Types) &&
+			!s.Delivery.Position.Since.Before(before.Add(10*time.Second))
+	})).Return(nil)
+
+	SubscriptionRoute(CreateSubscription(mockClient, 10, log)).ServeHTTP(w, req)
+
+	assert.Equal(t, 201, w.Code)
+	mockClient.AssertExpectations(t)
+
+	var created model.Subscription
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	assert.Len(t, created.Secret, 64, "The secret should be returned when the subscription is created")
+	assert.Equal(t, subscriptionsPath+"/"+created.ID, w.Header().Get("Location"))
+}
+
+func TestCreateSubscriptionKeepsGivenSecret(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("POST", "http://our.host.name/__subscriptions", strings.NewReader(`{"callbackUrl":"https://example.com/hook","secret":"shh"}`))
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockClient.On("CreateSubscription", mock.MatchedBy(func(s model.Subscription) bool { return s.Secret == "shh" })).Return(nil)
+
+	SubscriptionRoute(CreateSubscription(mockClient, 10, log)).ServeHTTP(w, req)
+
+	assert.Equal(t, 201, w.Code)
+	mockClient.AssertExpectations(t)
+}
+
+func TestCreateInvalidSubscription(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+
+	for _, body := range []string{
+		``,
+		`{}`,
+		`{"callbackUrl":"/relative"}`,
+		`{"callbackUrl":"ftp://example.com/hook"}`,
+		`{"callbackUrl":"http://example.com/hook"}`,
+		`{"callbackUrl":"https://127.0.0.1:8080/__health"}`,
+		`{"callbackUrl":"https://list-notifications-rw.default.svc.cluster.local/hook"}`,
+		`{"callbackUrl":"https://example.com/hook","uuids":["not-a-uuid"]}`,
+		`{"callbackUrl":"https://example.com/hook","types":["PUBLISH"]}`,
+	} {
+		req, _ := http.NewRequest("POST", "http://our.host.name/__subscriptions", strings.NewReader(body))
+		w := httptest.NewRecorder()
+
+		mockClient := new(MockClient)
+		SubscriptionRoute(CreateSubscription(mockClient, 10, log)).ServeHTTP(w, req)
+
+		assert.Equal(t, 400, w.Code, body)
+		mockClient.AssertNotCalled(t, "CreateSubscription", mock.Anything)
+	}
+}
+
+func TestReadSubscriptionsHidesSecrets(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("GET", "http://our.host.name/__subscriptions", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockClient.On("ReadSubscriptions").Return([]model.Subscription{{ID: "sub1", CallbackURL: "https://example.com/hook", Secret: "shh"}}, nil)
+
+	SubscriptionRoute(ReadSubscriptions(mockClient, log)).ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"id":"sub1"`)
+	assert.NotContains(t, w.Body.String(), "shh")
+}
+
+func TestReadSubscription(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("GET", "http://our.host.name/__subscriptions/sub1", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockClient.On("FindSubscription", "sub1").Return(model.Subscription{ID: "sub1", Secret: "shh"}, nil)
+
+	SubscriptionRoute(ReadSubscription(mockClient, log)).ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	assert.NotContains(t, w.Body.String(), "shh")
+}
+
+func TestSubscriptionNotFound(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+
+	mockClient := new(MockClient)
+	mockClient.On("FindSubscription", "missing").Return(model.Subscription{}, mongo.ErrNoDocuments)
+	mockClient.On("UpdateSubscription", mock.Anything).Return(mongo.ErrNoDocuments)
+	mockClient.On("DeleteSubscription", "missing").Return(mongo.ErrNoDocuments)
+
+	for method, handler := range map[string]func(w http.ResponseWriter, r *http.Request){
+		"GET":    ReadSubscription(mockClient, log),
+		"PUT":    UpdateSubscription(mockClient, log),
+		"DELETE": DeleteSubscription(mockClient, log),
+	} {
+		req, _ := http.NewRequest(method, "http://our.host.name/__subscriptions/missing", strings.NewReader(`{"callbackUrl":"https://example.com/hook"}`))
+		w := httptest.NewRecorder()
+
+		SubscriptionRoute(handler).ServeHTTP(w, req)
+
+		assert.Equal(t, 404, w.Code, method)
+	}
+}
+
+func TestUpdateSubscription(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("PUT", "http://our.host.name/__subscriptions/sub1", strings.NewReader(`{"callbackUrl":"https://example.com/new-hook","types":["DELETE"]}`))
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockClient.On("UpdateSubscription", model.Subscription{ID: "sub1", CallbackURL: "https://example.com/new-hook", Types: []string{"DELETE"}}).Return(nil)
+	mockClient.On("FindSubscription", "sub1").Return(model.Subscription{ID: "sub1", CallbackURL: "https://example.com/new-hook", Secret: "shh"}, nil)
+
+	SubscriptionRoute(UpdateSubscription(mockClient, log)).ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "new-hook")
+	assert.NotContains(t, w.Body.String(), "shh")
+	mockClient.AssertExpectations(t)
+}
+
+func TestDeleteSubscription(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("DELETE", "http://our.host.name/__subscriptions/sub1", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockClient.On("DeleteSubscription", "sub1").Return(nil)
+
+	SubscriptionRoute(DeleteSubscription(mockClient, log)).ServeHTTP(w, req)
+
+	assert.Equal(t, 204, w.Code)
+	mockClient.AssertExpectations(t)
+}
+
+func TestDeleteSubscriptionFails(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("DELETE", "http://our.host.name/__subscriptions/sub1", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockClient.On("DeleteSubscription", "sub1").Return(errors.New("mongo is down"))
+
+	SubscriptionRoute(DeleteSubscription(mockClient, log)).ServeHTTP(w, req)
+
+	assert.Equal(t, 500, w.Code)
+}
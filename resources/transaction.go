@@ -0,0 +1,82 @@
+package resources
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/list-notifications-rw/mapping"
+	"github.com/Financial-Times/list-notifications-rw/model"
+	"github.com/gorilla/mux"
+)
+
+// minTransactionIDPrefix is the shortest transaction id which may be matched as a prefix; shorter prefixes, such as
+// "tid_", would match most of the notifications
+const minTransactionIDPrefix = 8
+
+type transactionFinder interface {
+	limitGetter
+	FindNotificationsByTransactionID(transactionID string, prefix bool) ([]model.InternalNotification, error)
+}
+
+// ReadNotificationsByTransactionID returns the notifications produced by a publish, i.e. whose publishReference is the
+// transaction id, oldest first. With prefix=true, the notifications whose publishReference starts with the transaction id
+// are returned instead, such as those of carousel republishes; the prefix must be long enough not to match most of the
+// notifications. It responds 404 if there are none.
+func ReadNotificationsByTransactionID(mapper mapping.NotificationsMapper, finder transactionFinder, log *logger.UPPLogger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tid := strings.TrimSpace(mux.Vars(r)["tid"])
+		logEntry := log.WithField("transaction_id", tid)
+		if tid == "" {
+			logEntry.Info("User provided an empty transaction id.")
+			writeMessage("Please specify a transaction id.", 400, w)
+			return
+		}
+
+		prefix, err := getBoolParam(r, "prefix")
+		if err != nil {
+			logEntry.WithError(err).Info("User provided prefix is not a boolean!")
+			writeMessage("Please specify a boolean prefix.", 400, w)
+			return
+		}
+		if prefix && len(tid) < minTransactionIDPrefix {
+			logEntry.Info("User provided a transaction id prefix which is too short.")
+			writeMessage(fmt.Sprintf("Please specify a transaction id prefix of at least %d characters.", minTransactionIDPrefix), 400, w)
+			return
+		}
+
+		showItemChanges, err := getBoolParam(r, "itemChanges")
+		if err != nil {
+			logEntry.WithError(err).Info("User provided itemChanges is not a boolean!")
+			writeMessage("Please specify a boolean itemChanges.", 400, w)
+			return
+		}
+
+		showMetadata, err := getBoolParam(r, "listMetadata")
+		if err != nil {
+			logEntry.WithError(err).Info("User provided listMetadata is not a boolean!")
+			writeMessage("Please specify a boolean listMetadata.", 400, w)
+			return
+		}
+
+		notifications, err := finder.FindNotificationsByTransactionID(tid, prefix)
+		if err != nil {
+			logEntry.WithError(err).Error("Failed to query database for notifications by transaction id!")
+			writeMessage("Failed to retrieve list notifications due to internal server error", 500, w)
+			return
+		}
+
+		results := mapNotifications(mapper, notifications, 0, finder, showItemChanges, showMetadata, log)
+		if len(results) == 0 {
+			writeMessage("No list notifications found for this transaction id.", 404, w)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		if err = json.NewEncoder(w).Encode(results); err != nil {
+			logEntry.WithError(err).Error("Failed to encode notifications")
+		}
+	}
+}
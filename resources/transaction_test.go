@@ -0,0 +1,131 @@
+package resources
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/list-notifications-rw/model"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TransactionRoute(handler func(w http.ResponseWriter, r *http.Request)) *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/lists/notifications/by-transaction/{tid}", handler)
+	return r
+}
+
+func TestReadNotificationsByTransactionID(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	lastModified := time.Now().UTC().Add(-time.Hour)
+
+	req, _ := http.NewRequest("GET", "http://our.host.name/lists/notifications/by-transaction/tid_xyz?listMetadata=true", nil)
+	w := httptest.NewRecorder()
+
+	notifications := []model.InternalNotification{
+		{UUID: "uuid", Title: "Top Stories", EventType: "UPDATE", PublishReference: "tid_xyz", LastModified: lastModified, ListType: "TopStories"},
+		{UUID: "uuid2", Title: "Opinion", EventType: "DELETE", PublishReference: "tid_xyz", LastModified: lastModified},
+	}
+
+	mockClient := new(MockClient)
+	mockClient.On("GetLimit").Return(200)
+	mockClient.On("FindNotificationsByTransactionID", "tid_xyz", false).Return(notifications, nil)
+
+	TransactionRoute(ReadNotificationsByTransactionID(testMapper, mockClient, log)).ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	mockClient.AssertExpectations(t)
+
+	var results []model.PublicNotification
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&results))
+	require.Len(t, results, 2, "Every list changed by the publish should be returned")
+	assert.Equal(t, "http://testing-123.com/things/uuid", results[0].ID)
+	assert.Equal(t, "tid_xyz", results[0].PublishReference)
+	assert.Equal(t, "TopStories", results[0].ListType)
+	assert.Equal(t, "http://www.ft.com/thing/ThingChangeType/DELETE", results[1].Type)
+}
+
+func TestReadNotificationsByTransactionIDPrefix(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("GET", "http://our.host.name/lists/notifications/by-transaction/tid_xyz123?prefix=true", nil)
+	w := httptest.NewRecorder()
+
+	notifications := []model.InternalNotification{
+		{UUID: "uuid", EventType: "UPDATE", PublishReference: "tid_xyz123_carousel_1483461040", LastModified: time.Now().UTC()},
+	}
+
+	mockClient := new(MockClient)
+	mockClient.On("GetLimit").Return(200)
+	mockClient.On("FindNotificationsByTransactionID", "tid_xyz123", true).Return(notifications, nil)
+
+	TransactionRoute(ReadNotificationsByTransactionID(testMapper, mockClient, log)).ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	mockClient.AssertExpectations(t)
+	assert.Contains(t, w.Body.String(), `"publishReference":"tid_xyz123_carousel_1483461040"`)
+}
+
+func TestReadNotificationsByTransactionIDShortPrefix(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("GET", "http://our.host.name/lists/notifications/by-transaction/tid_?prefix=true", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+
+	TransactionRoute(ReadNotificationsByTransactionID(testMapper, mockClient, log)).ServeHTTP(w, req)
+
+	assert.Equal(t, 400, w.Code)
+	assert.Equal(t, "{\"message\":\"Please specify a transaction id prefix of at least 8 characters.\"}\n", w.Body.String())
+	mockClient.AssertNotCalled(t, "FindNotificationsByTransactionID", mock.Anything, mock.Anything)
+}
+
+func TestReadNotificationsByTransactionIDNotFound(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("GET", "http://our.host.name/lists/notifications/by-transaction/tid_unknown", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockClient.On("FindNotificationsByTransactionID", "tid_unknown", false).Return([]model.InternalNotification{}, nil)
+
+	TransactionRoute(ReadNotificationsByTransactionID(testMapper, mockClient, log)).ServeHTTP(w, req)
+
+	assert.Equal(t, 404, w.Code)
+	assert.Equal(t, "{\"message\":\"No list notifications found for this transaction id.\"}\n", w.Body.String())
+	mockClient.AssertExpectations(t)
+}
+
+func TestReadNotificationsByTransactionIDFailedDatabase(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("GET", "http://our.host.name/lists/notifications/by-transaction/tid_xyz", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockClient.On("FindNotificationsByTransactionID", "tid_xyz", false).Return(nil, errors.New("no db"))
+
+	TransactionRoute(ReadNotificationsByTransactionID(testMapper, mockClient, log)).ServeHTTP(w, req)
+
+	assert.Equal(t, 500, w.Code)
+	mockClient.AssertExpectations(t)
+}
+
+func TestReadNotificationsByTransactionIDJunkPrefix(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("GET", "http://our.host.name/lists/notifications/by-transaction/tid_xyz?prefix=sometimes", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+
+	TransactionRoute(ReadNotificationsByTransactionID(testMapper, mockClient, log)).ServeHTTP(w, req)
+
+	assert.Equal(t, 400, w.Code)
+	assert.Equal(t, "{\"message\":\"Please specify a boolean prefix.\"}\n", w.Body.String())
+	mockClient.AssertNotCalled(t, "FindNotificationsByTransactionID", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,116 @@
+package resources
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/list-notifications-rw/model"
+)
+
+// maxWait is the longest a reader may long-poll for notifications; it must be well within the server's write timeout.
+const maxWait = 30 * time.Second
+
+// waitPollInterval is how often long-polling readers check the db for notifications written by other instances.
+const waitPollInterval = 5 * time.Second
+
+// Notifier wakes readers which are long-polling for notifications, once a notification written by this instance is
+// past the cache delay, and so can be read.
+type Notifier struct {
+	cacheDelay time.Duration
+	mu         sync.Mutex
+	visible    chan struct{}
+}
+
+// NewNotifier creates a Notifier for notifications which can be read cacheDelay seconds after they are written.
+func NewNotifier(cacheDelay int) *Notifier {
+	return &Notifier{
+		cacheDelay: time.Duration(cacheDelay) * time.Second,
+		visible:    make(chan struct{}),
+	}
+}
+
+// Notify wakes every waiting reader once the cache delay has passed.
+func (n *Notifier) Notify() {
+	time.AfterFunc(n.cacheDelay, n.broadcast)
+}
+
+// Visible returns a channel which is closed when the next notification written by this instance can be read. A nil
+// Notifier never wakes readers, so they fall back to polling the db.
+func (n *Notifier) Visible() <-chan struct{} {
+	if n == nil {
+		return nil
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.visible
+}
+
+func (n *Notifier) broadcast() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	close(n.visible)
+	n.visible = make(chan struct{})
+}
+
+type notifiedWriter interface {
+	notificationWriter
+	batchWriter
+}
+
+// NotifyingWriter writes notifications, and then notifies readers which are long-polling for them.
+type NotifyingWriter struct {
+	notifiedWriter
+	notifier *Notifier
+}
+
+// NewNotifyingWriter wraps the writer so that every write notifies the notifier.
+func NewNotifyingWriter(writer notifiedWriter, notifier *Notifier) NotifyingWriter {
+	return NotifyingWriter{notifiedWriter: writer, notifier: notifier}
+}
+
+// WriteNotification writes the notification, and notifies waiting readers if it was successful.
+func (w NotifyingWriter) WriteNotification(notification *model.InternalNotification) error {
+	err := w.notifiedWriter.WriteNotification(notification)
+	if err == nil {
+		w.notifier.Notify()
+	}
+	return err
+}
+
+// WriteNotifications writes the notifications, and notifies waiting readers; some notifications may have been written
+// even if there was an error, and waking a reader unnecessarily only costs it another read.
+func (w NotifyingWriter) WriteNotifications(notifications []*model.InternalNotification) error {
+	err := w.notifiedWriter.WriteNotifications(notifications)
+	w.notifier.Notify()
+	return err
+}
+
+// waitForNotifications reads notifications until there are some, the wait expires, or the request is cancelled. It
+// reads again whenever this instance writes a notification, and polls in case other instances have written any.
+func waitForNotifications(ctx context.Context, wait time.Duration, pollInterval time.Duration, notifier *Notifier, read func() (*[]model.InternalNotification, error)) (*[]model.InternalNotification, error) {
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+
+	poll := time.NewTicker(pollInterval)
+	defer poll.Stop()
+
+	notifications := &[]model.InternalNotification{}
+	for {
+		select {
+		case <-ctx.Done():
+			return notifications, nil
+		case <-timeout.C:
+			return notifications, nil
+		case <-notifier.Visible():
+		case <-poll.C:
+		}
+
+		var err error
+		notifications, err = read()
+		if err != nil || len(*notifications) > 0 {
+			return notifications, err
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package resources
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/list-notifications-rw/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifierWakesWaitingReaders(t *testing.T) {
+	notifier := NewNotifier(0)
+
+	visible := notifier.Visible()
+	notifier.Notify()
+
+	select {
+	case <-visible:
+	case <-time.After(time.Second):
+		t.Fatal("The waiting reader should have been woken")
+	}
+
+	assert.NotEqual(t, visible, notifier.Visible(), "Readers should wait for the next notification")
+}
+
+func TestNilNotifierNeverWakes(t *testing.T) {
+	var notifier *Notifier
+	assert.Nil(t, notifier.Visible())
+}
+
+func TestNotifyingWriter(t *testing.T) {
+	notifier := NewNotifier(0)
+	mockClient := new(MockClient)
+	writer := NewNotifyingWriter(mockClient, notifier)
+
+	notification := &model.InternalNotification{UUID: "uuid"}
+	mockClient.On("WriteNotification", notification).Return(errors.New("i broke")).Once()
+	mockClient.On("WriteNotification", notification).Return(nil).Once()
+
+	visible := notifier.Visible()
+	assert.Error(t, writer.WriteNotification(notification))
+	select {
+	case <-visible:
+		t.Fatal("Failed writes should not wake readers")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	assert.NoError(t, writer.WriteNotification(notification))
+	select {
+	case <-visible:
+	case <-time.After(time.Second):
+		t.Fatal("Successful writes should wake readers")
+	}
+
+	mockClient.AssertExpectations(t)
+}
+
+func TestWaitForNotificationsWokenByWrite(t *testing.T) {
+	notifier := NewNotifier(0)
+
+	expected := []model.InternalNotification{{UUID: "uuid"}}
+	reads := 0
+	read := func() (*[]model.InternalNotification, error) {
+		reads++
+		return &expected, nil
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		notifier.Notify()
+	}()
+
+	notifications, err := waitForNotifications(context.Background(), 5*time.Second, time.Hour, notifier, read)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, *notifications)
+	assert.Equal(t, 1, reads)
+}
+
+func TestWaitForNotificationsPollsWithoutNotifier(t *testing.T) {
+	expected := []model.InternalNotification{{UUID: "uuid"}}
+	reads := 0
+	read := func() (*[]model.InternalNotification, error) {
+		reads++
+		if reads < 3 {
+			return &[]model.InternalNotification{}, nil
+		}
+		return &expected, nil
+	}
+
+	notifications, err := waitForNotifications(context.Background(), 5*time.Second, 10*time.Millisecond, nil, read)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, *notifications)
+	assert.Equal(t, 3, reads)
+}
+
+func TestWaitForNotificationsTimesOut(t *testing.T) {
+	read := func() (*[]model.InternalNotification, error) {
+		return &[]model.InternalNotification{}, nil
+	}
+
+	start := time.Now()
+	notifications, err := waitForNotifications(context.Background(), 50*time.Millisecond, 10*time.Millisecond, nil, read)
+	assert.NoError(t, err)
+	assert.NotNil(t, notifications)
+	assert.Empty(t, *notifications)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestWaitForNotificationsReturnsErrors(t *testing.T) {
+	read := func() (*[]model.InternalNotification, error) {
+		return nil, errors.New("i broke")
+	}
+
+	_, err := waitForNotifications(context.Background(), time.Second, 10*time.Millisecond, nil, read)
+	assert.EqualError(t, err, "i broke")
+}
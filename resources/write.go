@@ -2,16 +2,33 @@ package resources
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httputil"
+	"time"
 
 	"github.com/Financial-Times/go-logger/v2"
 	"github.com/Financial-Times/list-notifications-rw/mapping"
 	"github.com/Financial-Times/list-notifications-rw/model"
 	"github.com/gorilla/mux"
+	"github.com/rcrowley/go-metrics"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// staleWrites counts the notifications rejected because a newer notification had already been recorded for the list
+var staleWrites = metrics.GetOrRegisterCounter("list_notifications_stale_writes", metrics.DefaultRegistry)
+
+type latestNotificationFinder interface {
+	FindLatestNotification(uuid string) (model.InternalNotification, error)
+}
+
+type recordedNotificationFinder interface {
+	FindRecordedNotification(uuid string, publishReference string) (model.InternalNotification, error)
+}
+
 type notificationWriter interface {
+	latestNotificationFinder
+	recordedNotificationFinder
 	WriteNotification(notification *model.InternalNotification) error
 }
 
@@ -24,9 +41,10 @@ func WriteNotification(dumpRequests bool, mapper mapping.NotificationsMapper, wr
 
 		decoder := json.NewDecoder(r.Body)
 		uuid := mux.Vars(r)["uuid"]
+		tid := r.Header.Get(tidHeader)
 		logEntry := log.WithFields(map[string]any{
 			"uuid":           uuid,
-			"transaction_id": r.Header.Get("X-Request-Id"),
+			"transaction_id": tid,
 		})
 
 		notification, err := mapper.MapRequestToInternalNotification(uuid, decoder)
@@ -38,19 +56,167 @@ func WriteNotification(dumpRequests bool, mapper mapping.NotificationsMapper, wr
 			return
 		}
 
-		if err = writer.WriteNotification(notification); err != nil {
-			logEntry.WithError(err).Error("Failed to write notification")
-			if err = writeMessage("Failed to write notification.", 500, w); err != nil {
-				logEntry.WithError(err).Error("Failed to write message for unsuccessful notification write")
+		// notifications are unique by uuid and publishReference, so one without a publishReference would be recorded
+		// once, and every later one for the list would be skipped as a duplicate of it
+		if notification.PublishReference == "" {
+			notification.PublishReference = tid
+		}
+		if notification.PublishReference == "" {
+			logEntry.Error("Invalid request! The list has no publishReference, and there is no transaction id.")
+			if err = writeMessage("Invalid Request body; the list has no publishReference.", 400, w); err != nil {
+				logEntry.WithError(err).Error("Failed to write message for unsuccessful mapping of notification")
 			}
 			return
 		}
 
+		if !writeNotification(notification, writer, logEntry, w) {
+			return
+		}
+
 		logEntry.Info("Successfully processed a notification for this list.")
 		w.WriteHeader(200)
 	}
 }
 
+// DeleteNotification will write a new DELETE notification for the provided list.
+func DeleteNotification(dumpRequests bool, mapper mapping.NotificationsMapper, writer notificationWriter, log *logger.UPPLogger) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if dumpRequests {
+			dumpRequest(r, log)
+		}
+
+		uuid := mux.Vars(r)["uuid"]
+		tid := r.Header.Get(tidHeader)
+		logEntry := log.WithFields(map[string]any{
+			"uuid":           uuid,
+			"transaction_id": tid,
+		})
+
+		notification, err := mapper.MapDeleteRequestToInternalNotification(uuid, tid)
+		if err != nil {
+			logEntry.WithError(err).Error("Invalid request! See error for details.")
+			if err = writeMessage("Invalid Request.", 400, w); err != nil {
+				logEntry.WithError(err).Error("Failed to write message for unsuccessful mapping of notification")
+			}
+			return
+		}
+
+		if !writeNotification(notification, writer, logEntry, w) {
+			return
+		}
+
+		logEntry.Info("Successfully processed a delete notification for this list.")
+		w.WriteHeader(200)
+	}
+}
+
+// writeNotification writes the notification, and responds to the request if the write did not succeed.
+// It returns true if the caller should go on to report a successful write. A notification which has already been recorded
+// is reported as a duplicate before its order is checked, so that retrying a write is idempotent even once newer
+// notifications have been recorded for the list.
+func writeNotification(notification *model.InternalNotification, writer notificationWriter, logEntry *logger.LogEntry, w http.ResponseWriter) bool {
+	if isRecorded(notification, writer, logEntry) {
+		writeDuplicate(logEntry, w)
+		return false
+	}
+
+	if stale := compareWithPrevious(notification, writer, logEntry); stale {
+		staleWrites.Inc(1)
+		logEntry.WithField("lastModified", notification.LastModified).Warn("Rejecting notification; a newer notification has already been recorded for this list.")
+		if err := writeMessage("Rejecting notification; a newer notification has already been recorded for this list.", http.StatusConflict, w); err != nil {
+			logEntry.WithError(err).Error("Failed to write message for stale notification write")
+		}
+		return false
+	}
+
+	err := writer.WriteNotification(notification)
+	if err == nil {
+		return true
+	}
+
+	// the notification was recorded by a concurrent write since it was looked up
+	if mongo.IsDuplicateKeyError(err) {
+		writeDuplicate(logEntry, w)
+		return false
+	}
+
+	logEntry.WithError(err).Error("Failed to write notification")
+	if err = writeMessage("Failed to write notification.", 500, w); err != nil {
+		logEntry.WithError(err).Error("Failed to write message for unsuccessful notification write")
+	}
+	return false
+}
+
+// isRecorded returns true if the notification, i.e. its uuid and publishReference, has already been recorded. Failing to
+// look it up should not prevent the notification from being written, as the unique index still rejects a duplicate.
+func isRecorded(notification *model.InternalNotification, finder recordedNotificationFinder, logEntry *logger.LogEntry) bool {
+	_, err := finder.FindRecordedNotification(notification.UUID, notification.PublishReference)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return false
+	default:
+		logEntry.WithError(err).Warn("Failed to check whether this notification has already been recorded.")
+		return false
+	}
+}
+
+func writeDuplicate(logEntry *logger.LogEntry, w http.ResponseWriter) {
+	logEntry.Info("Skipping duplicate notification; it has already been recorded.")
+	if err := writeMessage("Skipping duplicate notification; it has already been recorded.", 200, w); err != nil {
+		logEntry.WithError(err).Error("Failed to write message for duplicate notification write")
+	}
+}
+
+// compareWithPrevious records the item changes since the previous notification for this list, and returns true if the notification
+// is stale, i.e. it was last modified before the previous notification. Failing to find the previous notification should not prevent
+// the notification from being written, so the changes are left empty in that case.
+func compareWithPrevious(notification *model.InternalNotification, finder latestNotificationFinder, logEntry *logger.LogEntry) bool {
+	previous, ok := findPrevious(notification, finder, logEntry)
+	if !ok {
+		return false
+	}
+	return compareWith(previous, notification)
+}
+
+// findPrevious finds the latest notification recorded for the notification's list, which is nil if there is none. It
+// returns false if the lookup failed.
+func findPrevious(notification *model.InternalNotification, finder latestNotificationFinder, logEntry *logger.LogEntry) (*model.InternalNotification, bool) {
+	previous, err := finder.FindLatestNotification(notification.UUID)
+	switch {
+	case err == nil:
+		return &previous, true
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return nil, true
+	default:
+		logEntry.WithError(err).Warn("Failed to find the previous notification for this list; item changes will not be recorded.")
+		return nil, false
+	}
+}
+
+func compareWith(previous *model.InternalNotification, notification *model.InternalNotification) bool {
+	if isOlder(notification, previous) {
+		return true
+	}
+
+	mapping.DiffItems(previous, notification)
+	return false
+}
+
+// isOlder returns true if the notification was last modified before the previous notification. Backdated notifications
+// are ordered by their original lastModified date, rather than the date they were moved forward to.
+func isOlder(notification *model.InternalNotification, previous *model.InternalNotification) bool {
+	return previous != nil && !notification.LastModified.IsZero() && modifiedAt(notification).Before(modifiedAt(previous))
+}
+
+func modifiedAt(notification *model.InternalNotification) time.Time {
+	if !notification.OriginalLastModified.IsZero() {
+		return notification.OriginalLastModified
+	}
+	return notification.LastModified
+}
+
 func dumpRequest(r *http.Request, log *logger.UPPLogger) {
 	dump, err := httputil.DumpRequest(r, true)
 	if err != nil {
@@ -2,13 +2,19 @@ package resources
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/list-notifications-rw/mapping"
+	"github.com/Financial-Times/list-notifications-rw/model"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 var mockWriteBody = `{"uuid":"ef863741-709a-4062-a8f1-987c44db1db5","title":"Unlocking Yield Top Stories","concept":{"uuid":"3095386b-bb12-37af-bb7b-b84390937caf","prefLabel":"Investing 2.0: Unlocking Yield"},"listType":"SpecialReports","items":[{"uuid":"2b3c6398-7f3f-11e6-8e50-8ec15fb462f4"},{"uuid":"0de7bf4c-8c08-11e6-8aa5-f79f5696c731"},{"uuid":"6c9109fc-8b9c-11e6-8cb7-e7ada1d123b1"},{"uuid":"f3e173f2-8ae7-11e6-8aa5-f79f5696c731"},{"uuid":"5c94a898-8952-11e6-8aa5-f79f5696c731"}],"publishReference":"tid_uvo7bcngao","lastModified":"2016-10-20T17:08:37.668Z"}`
@@ -22,8 +28,17 @@ func TestWriteNotification(t *testing.T) {
 
 	decoder := json.NewDecoder(strings.NewReader(mockWriteBody))
 	expectedNotification, _ := testMapper.MapRequestToInternalNotification("ef863741-709a-4062-a8f1-987c44db1db5", decoder)
+	mapping.DiffItems(nil, expectedNotification)
 
-	mockClient.On("WriteNotification", expectedNotification).Return(nil)
+	mockClient.On("FindRecordedNotification", mock.Anything, mock.Anything).Return(model.InternalNotification{}, mongo.ErrNoDocuments)
+	mockClient.On("FindLatestNotification", "ef863741-709a-4062-a8f1-987c44db1db5").Return(nil, mongo.ErrNoDocuments)
+	mockClient.On("WriteNotification", mock.MatchedBy(func(n *model.InternalNotification) bool {
+		// the list is backdated, so it is moved forward to when it was received
+		actual, expected := *n, *expectedNotification
+		actual.ReceivedAt, expected.ReceivedAt = time.Time{}, time.Time{}
+		actual.LastModified, expected.LastModified = time.Time{}, time.Time{}
+		return assert.ObjectsAreEqual(expected, actual) && !n.ReceivedAt.IsZero() && n.LastModified.Equal(n.ReceivedAt)
+	})).Return(nil)
 
 	r := WriteRoute(WriteNotification(true, testMapper, mockClient, log))
 	r.ServeHTTP(w, req)
@@ -96,3 +111,310 @@ func TestInvalidUUIDInPath(t *testing.T) {
 
 	assert.Equal(t, 400, w.Code)
 }
+
+func TestWriteNotificationWithoutPublishReferenceUsesTransactionID(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("PUT", "http://our.host.name/lists/notifications/ef863741-709a-4062-a8f1-987c44db1db5", strings.NewReader(`{"uuid":"ef863741-709a-4062-a8f1-987c44db1db5","title":"Unlocking Yield Top Stories"}`))
+	req.Header.Add(tidHeader, "tid_fromtheheader")
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockClient.On("FindRecordedNotification", mock.Anything, mock.Anything).Return(model.InternalNotification{}, mongo.ErrNoDocuments)
+	mockClient.On("FindLatestNotification", mock.Anything).Return(nil, mongo.ErrNoDocuments)
+	mockClient.On("WriteNotification", mock.MatchedBy(func(n *model.InternalNotification) bool {
+		return n.PublishReference == "tid_fromtheheader"
+	})).Return(nil)
+
+	r := WriteRoute(WriteNotification(false, testMapper, mockClient, log))
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	mockClient.AssertExpectations(t)
+}
+
+func TestWriteNotificationWithoutPublishReferenceOrTransactionID(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("PUT", "http://our.host.name/lists/notifications/ef863741-709a-4062-a8f1-987c44db1db5", strings.NewReader(`{"uuid":"ef863741-709a-4062-a8f1-987c44db1db5","title":"Unlocking Yield Top Stories"}`))
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+
+	r := WriteRoute(WriteNotification(false, testMapper, mockClient, log))
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, 400, w.Code)
+	mockClient.AssertNotCalled(t, "WriteNotification", mock.Anything)
+}
+
+func TestDeleteNotification(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("DELETE", "http://our.host.name/lists/notifications/ef863741-709a-4062-a8f1-987c44db1db5", nil)
+	req.Header.Add(tidHeader, "tid_deletedeletedelete")
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockClient.On("FindRecordedNotification", mock.Anything, mock.Anything).Return(model.InternalNotification{}, mongo.ErrNoDocuments)
+	mockClient.On("FindLatestNotification", mock.Anything).Return(nil, mongo.ErrNoDocuments)
+	mockClient.On("WriteNotification", mock.MatchedBy(func(n *model.InternalNotification) bool {
+		return n.UUID == "ef863741-709a-4062-a8f1-987c44db1db5" &&
+			n.EventType == "DELETE" &&
+			n.PublishReference == "tid_deletedeletedelete" &&
+			!n.LastModified.IsZero()
+	})).Return(nil)
+
+	r := WriteRoute(DeleteNotification(true, testMapper, mockClient, log))
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	mockClient.AssertExpectations(t)
+}
+
+func TestDeleteNotificationWithoutTransactionID(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("DELETE", "http://our.host.name/lists/notifications/ef863741-709a-4062-a8f1-987c44db1db5", nil)
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+
+	r := WriteRoute(DeleteNotification(false, testMapper, mockClient, log))
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, 400, w.Code)
+	mockClient.AssertNotCalled(t, "WriteNotification", mock.Anything)
+}
+
+func TestDeleteInvalidUUIDInPath(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("DELETE", "http://our.host.name/lists/notifications/uuid", nil)
+	req.Header.Add(tidHeader, "tid_deletedeletedelete")
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+
+	r := WriteRoute(DeleteNotification(true, testMapper, mockClient, log))
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, 400, w.Code)
+	mockClient.AssertNotCalled(t, "WriteNotification", mock.Anything)
+}
+
+func TestDeleteFailedWrite(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("DELETE", "http://our.host.name/lists/notifications/ef863741-709a-4062-a8f1-987c44db1db5", nil)
+	req.Header.Add(tidHeader, "tid_deletedeletedelete")
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockClient.On("FindRecordedNotification", mock.Anything, mock.Anything).Return(model.InternalNotification{}, mongo.ErrNoDocuments)
+	mockClient.On("FindLatestNotification", mock.Anything).Return(nil, mongo.ErrNoDocuments)
+	mockClient.On("WriteNotification", mock.Anything).Return(errors.New("i broke"))
+
+	r := WriteRoute(DeleteNotification(true, testMapper, mockClient, log))
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, 500, w.Code)
+	mockClient.AssertExpectations(t)
+}
+
+func TestWriteDuplicateNotification(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("PUT", "http://our.host.name/lists/notifications/ef863741-709a-4062-a8f1-987c44db1db5", strings.NewReader(mockWriteBody))
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	duplicate := mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000, Message: "E11000 duplicate key error"}}}
+	mockClient.On("FindRecordedNotification", mock.Anything, mock.Anything).Return(model.InternalNotification{}, mongo.ErrNoDocuments)
+	mockClient.On("FindLatestNotification", mock.Anything).Return(nil, mongo.ErrNoDocuments)
+	mockClient.On("WriteNotification", mock.Anything).Return(duplicate)
+
+	r := WriteRoute(WriteNotification(true, testMapper, mockClient, log))
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "{\"message\":\"Skipping duplicate notification; it has already been recorded.\"}\n", w.Body.String())
+	mockClient.AssertExpectations(t)
+}
+
+func TestWriteFailed(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("PUT", "http://our.host.name/lists/notifications/ef863741-709a-4062-a8f1-987c44db1db5", strings.NewReader(mockWriteBody))
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockClient.On("FindRecordedNotification", mock.Anything, mock.Anything).Return(model.InternalNotification{}, mongo.ErrNoDocuments)
+	mockClient.On("FindLatestNotification", mock.Anything).Return(nil, mongo.ErrNoDocuments)
+	mockClient.On("WriteNotification", mock.Anything).Return(errors.New("i broke"))
+
+	r := WriteRoute(WriteNotification(true, testMapper, mockClient, log))
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, 500, w.Code)
+	mockClient.AssertExpectations(t)
+}
+
+func TestWriteNotificationRecordsItemChanges(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("PUT", "http://our.host.name/lists/notifications/ef863741-709a-4062-a8f1-987c44db1db5", strings.NewReader(mockWriteBody))
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	previous := model.InternalNotification{
+		UUID: "ef863741-709a-4062-a8f1-987c44db1db5",
+		Items: []model.ListItem{
+			{UUID: "0de7bf4c-8c08-11e6-8aa5-f79f5696c731"},
+			{UUID: "2b3c6398-7f3f-11e6-8e50-8ec15fb462f4"},
+			{UUID: "6c9109fc-8b9c-11e6-8cb7-e7ada1d123b1"},
+			{UUID: "f3e173f2-8ae7-11e6-8aa5-f79f5696c731"},
+			{UUID: "8f6fd1f6-8a8b-11e6-8aa5-f79f5696c731"},
+		},
+	}
+	mockClient.On("FindRecordedNotification", mock.Anything, mock.Anything).Return(model.InternalNotification{}, mongo.ErrNoDocuments)
+	mockClient.On("FindLatestNotification", "ef863741-709a-4062-a8f1-987c44db1db5").Return(previous, nil)
+	mockClient.On("WriteNotification", mock.MatchedBy(func(n *model.InternalNotification) bool {
+		return assert.ObjectsAreEqual([]string{"5c94a898-8952-11e6-8aa5-f79f5696c731"}, n.AddedItems) &&
+			assert.ObjectsAreEqual([]string{"8f6fd1f6-8a8b-11e6-8aa5-f79f5696c731"}, n.RemovedItems) &&
+			n.Reordered
+	})).Return(nil)
+
+	r := WriteRoute(WriteNotification(true, testMapper, mockClient, log))
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	mockClient.AssertExpectations(t)
+}
+
+func TestWriteNotificationWhenPreviousLookupFails(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("PUT", "http://our.host.name/lists/notifications/ef863741-709a-4062-a8f1-987c44db1db5", strings.NewReader(mockWriteBody))
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockClient.On("FindRecordedNotification", mock.Anything, mock.Anything).Return(model.InternalNotification{}, mongo.ErrNoDocuments)
+	mockClient.On("FindLatestNotification", "ef863741-709a-4062-a8f1-987c44db1db5").Return(nil, errors.New("i broke"))
+	mockClient.On("WriteNotification", mock.MatchedBy(func(n *model.InternalNotification) bool {
+		return n.AddedItems == nil && n.RemovedItems == nil && !n.Reordered
+	})).Return(nil)
+
+	r := WriteRoute(WriteNotification(true, testMapper, mockClient, log))
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	mockClient.AssertExpectations(t)
+}
+
+func TestWriteNotificationKeepsListMetadata(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("PUT", "http://our.host.name/lists/notifications/ef863741-709a-4062-a8f1-987c44db1db5", strings.NewReader(mockWriteBody))
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockClient.On("FindRecordedNotification", mock.Anything, mock.Anything).Return(model.InternalNotification{}, mongo.ErrNoDocuments)
+	mockClient.On("FindLatestNotification", mock.Anything).Return(nil, mongo.ErrNoDocuments)
+	mockClient.On("WriteNotification", mock.MatchedBy(func(n *model.InternalNotification) bool {
+		return n.ListType == "SpecialReports" &&
+			n.Concept != nil &&
+			n.Concept.UUID == "3095386b-bb12-37af-bb7b-b84390937caf" &&
+			n.Concept.PrefLabel == "Investing 2.0: Unlocking Yield"
+	})).Return(nil)
+
+	r := WriteRoute(WriteNotification(true, testMapper, mockClient, log))
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	mockClient.AssertExpectations(t)
+}
+
+func TestWriteStaleNotification(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("PUT", "http://our.host.name/lists/notifications/ef863741-709a-4062-a8f1-987c44db1db5", strings.NewReader(mockWriteBody))
+	w := httptest.NewRecorder()
+
+	newer, _ := time.Parse(time.RFC3339Nano, "2016-10-20T17:08:38Z")
+	mockClient := new(MockClient)
+	mockClient.On("FindRecordedNotification", mock.Anything, mock.Anything).Return(model.InternalNotification{}, mongo.ErrNoDocuments)
+	mockClient.On("FindLatestNotification", "ef863741-709a-4062-a8f1-987c44db1db5").Return(model.InternalNotification{LastModified: newer}, nil)
+
+	before := staleWrites.Count()
+
+	r := WriteRoute(WriteNotification(true, testMapper, mockClient, log))
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, 409, w.Code)
+	assert.Equal(t, "{\"message\":\"Rejecting notification; a newer notification has already been recorded for this list.\"}\n", w.Body.String())
+	assert.Equal(t, before+1, staleWrites.Count())
+	mockClient.AssertExpectations(t)
+	mockClient.AssertNotCalled(t, "WriteNotification", mock.Anything)
+}
+
+func TestWriteStaleBackdatedNotification(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("PUT", "http://our.host.name/lists/notifications/ef863741-709a-4062-a8f1-987c44db1db5", strings.NewReader(mockWriteBody))
+	w := httptest.NewRecorder()
+
+	// the latest notification was also backdated, so both are moved forward, but it was originally modified later
+	newer, _ := time.Parse(time.RFC3339Nano, "2016-10-20T17:08:38Z")
+	mockClient := new(MockClient)
+	mockClient.On("FindRecordedNotification", mock.Anything, mock.Anything).Return(model.InternalNotification{}, mongo.ErrNoDocuments)
+	mockClient.On("FindLatestNotification", "ef863741-709a-4062-a8f1-987c44db1db5").Return(model.InternalNotification{LastModified: time.Now().UTC(), OriginalLastModified: newer}, nil)
+
+	r := WriteRoute(WriteNotification(true, testMapper, mockClient, log))
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, 409, w.Code)
+	mockClient.AssertExpectations(t)
+	mockClient.AssertNotCalled(t, "WriteNotification", mock.Anything)
+}
+
+func TestWriteRecordedNotificationIsDuplicateEvenWhenStale(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	req, _ := http.NewRequest("PUT", "http://our.host.name/lists/notifications/ef863741-709a-4062-a8f1-987c44db1db5", strings.NewReader(mockWriteBody))
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockClient.On("FindRecordedNotification", "ef863741-709a-4062-a8f1-987c44db1db5", "tid_uvo7bcngao").Return(model.InternalNotification{PublishReference: "tid_uvo7bcngao"}, nil)
+
+	r := WriteRoute(WriteNotification(true, testMapper, mockClient, log))
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code, "A retry of a recorded notification should be a duplicate, even if newer notifications have been recorded since")
+	assert.Equal(t, "{\"message\":\"Skipping duplicate notification; it has already been recorded.\"}\n", w.Body.String())
+	mockClient.AssertExpectations(t)
+	mockClient.AssertNotCalled(t, "FindLatestNotification", mock.Anything)
+	mockClient.AssertNotCalled(t, "WriteNotification", mock.Anything)
+}
+
+func TestWriteNotificationWithFutureLastModified(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	body := `{"uuid":"ef863741-709a-4062-a8f1-987c44db1db5","title":"Unlocking Yield Top Stories","publishReference":"tid_uvo7bcngao","lastModified":"` + time.Now().Add(time.Hour).Format(time.RFC3339Nano) + `"}`
+	req, _ := http.NewRequest("PUT", "http://our.host.name/lists/notifications/ef863741-709a-4062-a8f1-987c44db1db5", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mapper := mapping.DefaultMapper{ApiHost: "testing-123.com", LastModified: mapping.LastModifiedPolicy{MaxSkew: time.Minute}}
+
+	r := WriteRoute(WriteNotification(true, mapper, mockClient, log))
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, 400, w.Code)
+	mockClient.AssertNotCalled(t, "WriteNotification", mock.Anything)
+}
+
+func TestWriteNotificationWithoutLastModified(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	body := `{"uuid":"ef863741-709a-4062-a8f1-987c44db1db5","title":"Unlocking Yield Top Stories","publishReference":"tid_uvo7bcngao"}`
+	req, _ := http.NewRequest("PUT", "http://our.host.name/lists/notifications/ef863741-709a-4062-a8f1-987c44db1db5", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	mockClient := new(MockClient)
+	mockClient.On("FindRecordedNotification", mock.Anything, mock.Anything).Return(model.InternalNotification{}, mongo.ErrNoDocuments)
+	mockClient.On("FindLatestNotification", mock.Anything).Return(nil, mongo.ErrNoDocuments)
+	mockClient.On("WriteNotification", mock.MatchedBy(func(n *model.InternalNotification) bool {
+		return !n.LastModified.IsZero() && n.LastModified.Equal(n.ReceivedAt)
+	})).Return(nil)
+
+	r := WriteRoute(WriteNotification(true, testMapper, mockClient, log))
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	mockClient.AssertExpectations(t)
+}
@@ -0,0 +1,76 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var errInternalCallback = errors.New("callbackUrl must not be a local or internal address")
+
+// internalSuffixes are the host name suffixes which only resolve inside the cluster or on the local network
+var internalSuffixes = []string{".localhost", ".local", ".internal", ".svc", ".localdomain"}
+
+// ValidateCallbackURL checks that the callback url is an absolute https url, whose host is not a loopback, private or
+// otherwise internal address, so that subscriptions cannot be used to make requests inside the cluster.
+func ValidateCallbackURL(callbackURL string) error {
+	callback, err := url.Parse(callbackURL)
+	if err != nil || callback.Scheme != "https" || callback.Hostname() == "" {
+		return errors.New("callbackUrl must be an absolute https url")
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(callback.Hostname(), "."))
+	if ip := net.ParseIP(host); ip != nil {
+		if !isPublic(ip) {
+			return errInternalCallback
+		}
+		return nil
+	}
+
+	if host == "localhost" || !strings.Contains(host, ".") {
+		return errInternalCallback
+	}
+	for _, suffix := range internalSuffixes {
+		if strings.HasSuffix(host, suffix) {
+			return errInternalCallback
+		}
+	}
+	return nil
+}
+
+// NewClient returns the http client to deliver webhooks with. It refuses to connect to internal addresses, so that a
+// callback host which resolves to one (or redirects to one) cannot be used to make requests inside the cluster.
+func NewClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   refuseInternal,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Transport: transport}
+}
+
+func refuseInternal(_ string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	if ip := net.ParseIP(host); ip == nil || !isPublic(ip) {
+		return fmt.Errorf("refusing to deliver a webhook to internal address %s", address)
+	}
+	return nil
+}
+
+func isPublic(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() && !ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast() && !ip.IsMulticast()
+}
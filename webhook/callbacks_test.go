@@ -0,0 +1,40 @@
+package webhook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateCallbackURL(t *testing.T) {
+	for callback, valid := range map[string]bool{
+		"https://example.com/hook":                              true,
+		"https://93.184.216.34/hook":                            true,
+		"http://example.com/hook":                               false,
+		"ftp://example.com/hook":                                false,
+		"/relative":                                             false,
+		"https://localhost/hook":                                false,
+		"https://127.0.0.1:8080/hook":                           false,
+		"https://10.0.0.1/hook":                                 false,
+		"https://[::1]/hook":                                    false,
+		"https://169.254.169.254/latest/meta-data":              false,
+		"https://list-notifications-rw:8080/__health":           false,
+		"https://list-notifications-rw.default.svc/hook":        false,
+		"https://list-notifications-rw.default.cluster.local./": false,
+	} {
+		err := ValidateCallbackURL(callback)
+		assert.Equal(t, valid, err == nil, callback)
+	}
+}
+
+func TestClientRefusesInternalAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+	defer server.Close()
+
+	_, err := NewClient().Get(server.URL)
+	assert.Error(t, err, "The client should refuse to connect to the loopback address")
+}
@@ -0,0 +1,314 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/list-notifications-rw/mapping"
+	"github.com/Financial-Times/list-notifications-rw/model"
+	"github.com/rcrowley/go-metrics"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// SignatureHeader carries the hex encoded HMAC-SHA256 of the request body, keyed with the subscription secret.
+const SignatureHeader = "X-Signature"
+
+type store interface {
+	ReadSubscriptions() ([]model.Subscription, error)
+	UpdateSubscriptionDelivery(id string, delivery model.SubscriptionDelivery) error
+	WriteDeadLetter(deadLetter model.DeadLetter) error
+	AcquireWebhookLease(owner string, ttl time.Duration) (bool, error)
+	ReadNotifications(offset int, limit int, since time.Time, filter model.NotificationFilter) (*[]model.InternalNotification, error)
+	GetLimit() int
+}
+
+// Config configures how often the Dispatcher polls for notifications, and how it retries failed deliveries.
+type Config struct {
+	Owner        string        // Identifies this instance when taking the delivery lease.
+	PollInterval time.Duration // How long to wait between polls for notifications.
+	CacheDelay   int           // The number of seconds before a written notification can be read.
+	MinBackoff   time.Duration // The delay before the first retry, doubled for each subsequent attempt.
+	MaxBackoff   time.Duration // The max delay between retries.
+	MaxAttempts  int           // The number of attempts before a notification is dead lettered.
+	Timeout      time.Duration // How long a callback may take to respond.
+}
+
+// Dispatcher delivers notifications to webhook subscriptions in the background. Each subscription is sent its
+// notifications in order, one POST per notification; if one fails, later notifications wait until it has been retried
+// successfully, or dead lettered.
+type Dispatcher struct {
+	config Config
+	store  store
+	client *http.Client
+	mapper mapping.NotificationsMapper
+	log    *logger.UPPLogger
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// NewDispatcher creates a Dispatcher; call Start to begin delivering.
+func NewDispatcher(config Config, store store, client *http.Client, mapper mapping.NotificationsMapper, log *logger.UPPLogger) *Dispatcher {
+	return &Dispatcher{
+		config: config,
+		store:  store,
+		client: client,
+		mapper: mapper,
+		log:    log,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// Start begins delivering in a background goroutine.
+func (d *Dispatcher) Start() {
+	go d.run()
+}
+
+// Stop waits for the current poll to finish, then stops delivering.
+func (d *Dispatcher) Stop() {
+	close(d.stop)
+	<-d.done
+}
+
+func (d *Dispatcher) run() {
+	defer close(d.done)
+
+	ticker := time.NewTicker(d.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+			d.poll()
+		}
+	}
+}
+
+func (d *Dispatcher) poll() {
+	if !d.lease() {
+		return // another instance is delivering
+	}
+
+	d.dispatch(time.Now().UTC())
+}
+
+// lease takes or renews the delivery lease, which lasts long enough to deliver one more notification. It is renewed
+// before each delivery, so that another instance cannot take it over, and deliver to the same subscriptions, mid-poll.
+func (d *Dispatcher) lease() bool {
+	leased, err := d.store.AcquireWebhookLease(d.config.Owner, 3*d.config.PollInterval+d.config.Timeout)
+	if err != nil {
+		d.log.WithError(err).Error("Failed to acquire the webhook lease")
+		return false
+	}
+	return leased
+}
+
+// dispatch delivers the next page of notifications to every subscription which is not waiting to retry.
+func (d *Dispatcher) dispatch(now time.Time) {
+	subscriptions, err := d.store.ReadSubscriptions()
+	if err != nil {
+		d.log.WithError(err).Error("Failed to read webhook subscriptions")
+		return
+	}
+
+	for _, subscription := range subscriptions {
+		if subscription.Delivery.NextAttemptAt.After(now) {
+			continue
+		}
+		if !d.deliverPage(subscription, now) {
+			return
+		}
+	}
+}
+
+// deliverPage delivers the notifications after the subscription's position, stopping at the first failure. It returns
+// false if the lease was lost, in which case the delivery is not recorded, as another instance may now be recording it;
+// the notifications delivered since the last recorded position will be delivered again.
+func (d *Dispatcher) deliverPage(subscription model.Subscription, now time.Time) bool {
+	logEntry := d.log.WithField("subscription", subscription.ID)
+
+	filter, err := subscriptionFilter(subscription)
+	if err != nil {
+		logEntry.WithError(err).Error("Skipping webhook subscription with an invalid filter.")
+		return true
+	}
+
+	delivery := subscription.Delivery
+	notifications, err := d.store.ReadNotifications(delivery.Position.Offset, 0, delivery.Position.Since, filter)
+	if err != nil {
+		logEntry.WithError(err).Error("Failed to query database for notifications to deliver!")
+		return true
+	}
+
+	cacheDelay := time.Duration(d.config.CacheDelay) * time.Second
+	progressed := false
+	for i, n := range *notifications {
+		if i >= d.store.GetLimit() {
+			break
+		}
+
+		public, err := d.mapper.MapInternalNotificationToPublic(n)
+		if err != nil { // this notification can never be delivered, so don't let it block the subscription
+			logEntry.WithError(err).WithField("uuid", n.UUID).WithField("transaction_id", n.PublishReference).Warn("Skipping notification which cannot be mapped to the public format.")
+			delivery.Position = mapping.AdvancePosition(delivery.Position, n, cacheDelay)
+			progressed = true
+			continue
+		}
+
+		if !d.lease() {
+			logEntry.Warn("Lost the webhook lease, another instance will deliver the rest of the notifications.")
+			return false
+		}
+
+		err = d.deliver(subscription, n.PublishReference, public)
+		if err == nil {
+			delivered(subscription.ID).Inc(1)
+			delivery.Delivered++
+			delivery.Attempts = 0
+			delivery.LastError = ""
+			delivery.Position = mapping.AdvancePosition(delivery.Position, n, cacheDelay)
+			progressed = true
+			continue
+		}
+
+		failed(subscription.ID).Inc(1)
+		delivery.Failed++
+		delivery.Attempts++
+		delivery.LastError = err.Error()
+		notificationLog := logEntry.WithField("uuid", n.UUID).WithField("transaction_id", n.PublishReference).WithField("attempts", delivery.Attempts)
+
+		if delivery.Attempts < d.config.MaxAttempts {
+			notificationLog.WithError(err).Warn("Failed to deliver webhook, it will be retried.")
+			delivery.NextAttemptAt = now.Add(d.backoff(delivery.Attempts))
+			d.updateDelivery(subscription.ID, delivery, logEntry)
+			return true
+		}
+
+		notificationLog.WithError(err).Error("Failed to deliver webhook after the max number of attempts, dead lettering it.")
+		err = d.store.WriteDeadLetter(model.DeadLetter{
+			ID:             subscription.ID + "/" + n.UUID + "/" + n.PublishReference,
+			SubscriptionID: subscription.ID,
+			Notification:   n,
+			Attempts:       delivery.Attempts,
+			LastError:      delivery.LastError,
+			CreatedAt:      now,
+		})
+		if mongo.IsDuplicateKeyError(err) {
+			// the dead letter was written by a previous attempt, whose delivery state failed to update
+			notificationLog.Info("Notification has already been dead lettered.")
+			err = nil
+		}
+		if err != nil {
+			notificationLog.WithError(err).Error("Failed to write dead letter, the webhook will be retried.")
+			delivery.NextAttemptAt = now.Add(d.backoff(delivery.Attempts))
+			d.updateDelivery(subscription.ID, delivery, logEntry)
+			return true
+		}
+
+		deadLettered(subscription.ID).Inc(1)
+		delivery.DeadLettered++
+		delivery.Attempts = 0
+		delivery.Position = mapping.AdvancePosition(delivery.Position, n, cacheDelay)
+		progressed = true
+	}
+
+	if progressed {
+		delivery.NextAttemptAt = time.Time{}
+		d.updateDelivery(subscription.ID, delivery, logEntry)
+	}
+	return true
+}
+
+func (d *Dispatcher) updateDelivery(id string, delivery model.SubscriptionDelivery, logEntry *logger.LogEntry) {
+	if err := d.store.UpdateSubscriptionDelivery(id, delivery); err != nil {
+		logEntry.WithError(err).Error("Failed to record webhook delivery, notifications may be delivered again.")
+	}
+}
+
+// deliver POSTs the public notification to the subscription's callback url, signed with the subscription's secret.
+func (d *Dispatcher) deliver(subscription model.Subscription, tid string, public model.PublicNotification) error {
+	body, err := json.Marshal(public)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.CallbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Request-Id", tid)
+	req.Header.Set(SignatureHeader, Sign([]byte(subscription.Secret), body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("callback responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// backoff returns the exponential delay before the given attempt is retried.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	backoff := d.config.MinBackoff
+	for i := 1; i < attempts && backoff < d.config.MaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > d.config.MaxBackoff {
+		return d.config.MaxBackoff
+	}
+	return backoff
+}
+
+// Sign returns the signature header value for the body, so receivers can check it was sent by this service.
+func Sign(secret []byte, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// subscriptionFilter reads every notification the subscription is filtered to, without collapsing them, so a list which is
+// written more than once between polls has each of its notifications delivered
+func subscriptionFilter(subscription model.Subscription) (model.NotificationFilter, error) {
+	filter := model.NotificationFilter{UUIDs: subscription.UUIDs, Uncollapsed: true}
+	for _, eventType := range subscription.Types {
+		stored, err := mapping.StoredEventTypes(eventType)
+		if err != nil {
+			return model.NotificationFilter{}, err
+		}
+		filter.EventTypes = append(filter.EventTypes, stored...)
+	}
+	return filter, nil
+}
+
+func delivered(id string) metrics.Counter {
+	return metrics.GetOrRegisterCounter("list_notifications_webhook_delivered."+id, metrics.DefaultRegistry)
+}
+
+func failed(id string) metrics.Counter {
+	return metrics.GetOrRegisterCounter("list_notifications_webhook_failed."+id, metrics.DefaultRegistry)
+}
+
+func deadLettered(id string) metrics.Counter {
+	return metrics.GetOrRegisterCounter("list_notifications_webhook_dead_lettered."+id, metrics.DefaultRegistry)
+}
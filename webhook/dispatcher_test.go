@@ -0,0 +1,308 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/list-notifications-rw/mapping"
+	"github.com/Financial-Times/list-notifications-rw/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var testConfig = Config{
+	Owner:        "test",
+	PollInterval: time.Second,
+	CacheDelay:   10,
+	MinBackoff:   time.Second,
+	MaxBackoff:   time.Minute,
+	MaxAttempts:  3,
+	Timeout:      time.Second,
+}
+
+var testMapper = mapping.DefaultMapper{ApiHost: "testing-123.com"}
+
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	status   int
+	received []*http.Request
+	bodies   [][]byte
+}
+
+func newReceiver(status int) *receiver {
+	r := &receiver{status: status}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.received = append(r.received, req)
+		r.bodies = append(r.bodies, body)
+		w.WriteHeader(r.status)
+	}))
+	return r
+}
+
+func notification(uuid, tid string, lastModified time.Time) model.InternalNotification {
+	return model.InternalNotification{
+		UUID:             uuid,
+		Title:            "Test list",
+		EventType:        "UPDATE",
+		PublishReference: tid,
+		LastModified:     lastModified,
+	}
+}
+
+func TestDispatchDeliversSignedNotifications(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	now := time.Now().UTC()
+	since := now.Add(-time.Minute)
+	first := notification("uuid1", "tid_1", since)
+	second := notification("uuid2", "tid_2", since.Add(time.Second))
+
+	callback := newReceiver(200)
+	defer callback.Close()
+
+	subscription := model.Subscription{
+		ID:          "sub1",
+		CallbackURL: callback.URL,
+		Secret:      "shh",
+		Types:       []string{"update"},
+		Delivery:    model.SubscriptionDelivery{Position: model.Position{Since: since}},
+	}
+
+	store := new(MockStore)
+	store.On("AcquireWebhookLease", "test", 4*time.Second).Return(true, nil).Maybe()
+	store.On("ReadSubscriptions").Return([]model.Subscription{subscription}, nil)
+	store.On("GetLimit").Return(10)
+	store.On("ReadNotifications", 0, 0, since, model.NotificationFilter{EventTypes: []string{"UPDATE", "http://www.ft.com/thing/ThingChangeType/UPDATE"}, Uncollapsed: true}).
+		Return(&[]model.InternalNotification{first, second}, nil)
+	store.On("UpdateSubscriptionDelivery", "sub1", model.SubscriptionDelivery{
+		Position:  model.Position{Since: second.LastModified.Add(10 * time.Second), Offset: 1},
+		Delivered: 2,
+	}).Return(nil)
+
+	NewDispatcher(testConfig, store, http.DefaultClient, testMapper, log).dispatch(now)
+
+	store.AssertExpectations(t)
+	if assert.Len(t, callback.received, 2) {
+		assert.Equal(t, "tid_1", callback.received[0].Header.Get("X-Request-Id"))
+		assert.Equal(t, "application/json", callback.received[0].Header.Get("Content-Type"))
+		assert.Equal(t, Sign([]byte("shh"), callback.bodies[0]), callback.received[0].Header.Get(SignatureHeader))
+
+		var public model.PublicNotification
+		assert.NoError(t, json.Unmarshal(callback.bodies[1], &public))
+		assert.Equal(t, "http://testing-123.com/lists/uuid2", public.APIURL)
+	}
+}
+
+func TestDispatchRetriesWithBackoff(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	now := time.Now().UTC()
+	since := now.Add(-time.Minute)
+
+	callback := newReceiver(503)
+	defer callback.Close()
+
+	subscription := model.Subscription{
+		ID:          "sub1",
+		CallbackURL: callback.URL,
+		Delivery:    model.SubscriptionDelivery{Position: model.Position{Since: since}, Attempts: 1, Failed: 1},
+	}
+
+	store := new(MockStore)
+	store.On("AcquireWebhookLease", "test", 4*time.Second).Return(true, nil).Maybe()
+	store.On("ReadSubscriptions").Return([]model.Subscription{subscription}, nil)
+	store.On("GetLimit").Return(10)
+	store.On("ReadNotifications", 0, 0, since, model.NotificationFilter{Uncollapsed: true}).
+		Return(&[]model.InternalNotification{notification("uuid1", "tid_1", since), notification("uuid2", "tid_2", since)}, nil)
+	store.On("UpdateSubscriptionDelivery", "sub1", model.SubscriptionDelivery{
+		Position:      model.Position{Since: since},
+		Attempts:      2,
+		Failed:        2,
+		NextAttemptAt: now.Add(2 * time.Second),
+		LastError:     "callback responded with status 503",
+	}).Return(nil)
+
+	NewDispatcher(testConfig, store, http.DefaultClient, testMapper, log).dispatch(now)
+
+	store.AssertExpectations(t)
+	assert.Len(t, callback.received, 1, "Later notifications should wait for the failed one to be retried")
+}
+
+func TestDispatchDeadLettersAfterMaxAttempts(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	now := time.Now().UTC()
+	since := now.Add(-time.Minute)
+	n := notification("uuid1", "tid_1", since)
+
+	callback := newReceiver(500)
+	defer callback.Close()
+
+	subscription := model.Subscription{
+		ID:          "sub1",
+		CallbackURL: callback.URL,
+		Delivery:    model.SubscriptionDelivery{Position: model.Position{Since: since}, Attempts: 2, Failed: 2},
+	}
+
+	store := new(MockStore)
+	store.On("AcquireWebhookLease", "test", 4*time.Second).Return(true, nil).Maybe()
+	store.On("ReadSubscriptions").Return([]model.Subscription{subscription}, nil)
+	store.On("GetLimit").Return(10)
+	store.On("ReadNotifications", 0, 0, since, model.NotificationFilter{Uncollapsed: true}).Return(&[]model.InternalNotification{n}, nil)
+	store.On("WriteDeadLetter", model.DeadLetter{
+		ID:             "sub1/uuid1/tid_1",
+		SubscriptionID: "sub1",
+		Notification:   n,
+		Attempts:       3,
+		LastError:      "callback responded with status 500",
+		CreatedAt:      now,
+	}).Return(nil)
+	store.On("UpdateSubscriptionDelivery", "sub1", model.SubscriptionDelivery{
+		Position:     model.Position{Since: since.Add(10 * time.Second), Offset: 1},
+		Failed:       3,
+		DeadLettered: 1,
+		LastError:    "callback responded with status 500",
+	}).Return(nil)
+
+	NewDispatcher(testConfig, store, http.DefaultClient, testMapper, log).dispatch(now)
+
+	store.AssertExpectations(t)
+}
+
+func TestDispatchTreatsAnExistingDeadLetterAsWritten(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	now := time.Now().UTC()
+	since := now.Add(-time.Minute)
+	n := notification("uuid1", "tid_1", since)
+
+	callback := newReceiver(500)
+	defer callback.Close()
+
+	subscription := model.Subscription{
+		ID:          "sub1",
+		CallbackURL: callback.URL,
+		Delivery:    model.SubscriptionDelivery{Position: model.Position{Since: since}, Attempts: 2, Failed: 2},
+	}
+
+	duplicate := mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000, Message: "duplicate key"}}}
+
+	store := new(MockStore)
+	store.On("AcquireWebhookLease", "test", 4*time.Second).Return(true, nil).Maybe()
+	store.On("ReadSubscriptions").Return([]model.Subscription{subscription}, nil)
+	store.On("GetLimit").Return(10)
+	store.On("ReadNotifications", 0, 0, since, model.NotificationFilter{Uncollapsed: true}).Return(&[]model.InternalNotification{n}, nil)
+	store.On("WriteDeadLetter", mock.Anything).Return(duplicate)
+	store.On("UpdateSubscriptionDelivery", "sub1", model.SubscriptionDelivery{
+		Position:     model.Position{Since: since.Add(10 * time.Second), Offset: 1},
+		Failed:       3,
+		DeadLettered: 1,
+		LastError:    "callback responded with status 500",
+	}).Return(nil)
+
+	NewDispatcher(testConfig, store, http.DefaultClient, testMapper, log).dispatch(now)
+
+	store.AssertExpectations(t)
+}
+
+func TestDispatchDeliversEveryNotificationForAList(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	now := time.Now().UTC()
+	since := now.Add(-time.Minute)
+
+	callback := newReceiver(200)
+	defer callback.Close()
+
+	subscription := model.Subscription{ID: "sub1", CallbackURL: callback.URL, Delivery: model.SubscriptionDelivery{Position: model.Position{Since: since}}}
+
+	store := new(MockStore)
+	store.On("AcquireWebhookLease", "test", 4*time.Second).Return(true, nil)
+	store.On("ReadSubscriptions").Return([]model.Subscription{subscription}, nil)
+	store.On("GetLimit").Return(10)
+	store.On("ReadNotifications", 0, 0, since, model.NotificationFilter{Uncollapsed: true}).
+		Return(&[]model.InternalNotification{notification("uuid1", "tid_1", since), notification("uuid1", "tid_2", since.Add(time.Second))}, nil)
+	store.On("UpdateSubscriptionDelivery", "sub1", mock.Anything).Return(nil)
+
+	NewDispatcher(testConfig, store, http.DefaultClient, testMapper, log).dispatch(now)
+
+	store.AssertExpectations(t)
+	if assert.Len(t, callback.received, 2, "Both writes to the list should be delivered") {
+		assert.Equal(t, "tid_1", callback.received[0].Header.Get("X-Request-Id"))
+		assert.Equal(t, "tid_2", callback.received[1].Header.Get("X-Request-Id"))
+	}
+}
+
+func TestDispatchStopsWhenLeaseIsLost(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	now := time.Now().UTC()
+	since := now.Add(-time.Minute)
+
+	callback := newReceiver(200)
+	defer callback.Close()
+
+	subscriptions := []model.Subscription{
+		{ID: "sub1", CallbackURL: callback.URL, Delivery: model.SubscriptionDelivery{Position: model.Position{Since: since}}},
+		{ID: "sub2", CallbackURL: callback.URL, Delivery: model.SubscriptionDelivery{Position: model.Position{Since: since}}},
+	}
+
+	store := new(MockStore)
+	store.On("AcquireWebhookLease", "test", 4*time.Second).Return(true, nil).Once()
+	store.On("AcquireWebhookLease", "test", 4*time.Second).Return(false, nil).Once()
+	store.On("ReadSubscriptions").Return(subscriptions, nil)
+	store.On("GetLimit").Return(10)
+	store.On("ReadNotifications", 0, 0, since, model.NotificationFilter{Uncollapsed: true}).
+		Return(&[]model.InternalNotification{notification("uuid1", "tid_1", since), notification("uuid2", "tid_2", since.Add(time.Second))}, nil)
+
+	NewDispatcher(testConfig, store, http.DefaultClient, testMapper, log).dispatch(now)
+
+	store.AssertExpectations(t)
+	assert.Len(t, callback.received, 1, "Nothing should be delivered once another instance may hold the lease")
+	store.AssertNotCalled(t, "UpdateSubscriptionDelivery", mock.Anything, mock.Anything)
+}
+
+func TestDispatchSkipsSubscriptionsWaitingToRetry(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+	now := time.Now().UTC()
+
+	store := new(MockStore)
+	store.On("AcquireWebhookLease", "test", 4*time.Second).Return(true, nil).Maybe()
+	store.On("ReadSubscriptions").Return([]model.Subscription{{
+		ID:       "sub1",
+		Delivery: model.SubscriptionDelivery{NextAttemptAt: now.Add(time.Second)},
+	}}, nil)
+
+	NewDispatcher(testConfig, store, http.DefaultClient, testMapper, log).dispatch(now)
+
+	store.AssertExpectations(t)
+	store.AssertNotCalled(t, "ReadNotifications", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestPollRequiresLease(t *testing.T) {
+	log := logger.NewUPPLogger("test", "debug")
+
+	store := new(MockStore)
+	store.On("AcquireWebhookLease", "test", 4*time.Second).Return(false, nil)
+
+	NewDispatcher(testConfig, store, http.DefaultClient, testMapper, log).poll()
+
+	store.AssertExpectations(t)
+	store.AssertNotCalled(t, "ReadSubscriptions")
+}
+
+func TestBackoff(t *testing.T) {
+	d := NewDispatcher(testConfig, nil, nil, testMapper, nil)
+
+	assert.Equal(t, time.Second, d.backoff(1))
+	assert.Equal(t, 2*time.Second, d.backoff(2))
+	assert.Equal(t, 32*time.Second, d.backoff(6))
+	assert.Equal(t, time.Minute, d.backoff(7))
+	assert.Equal(t, time.Minute, d.backoff(100))
+}
@@ -0,0 +1,50 @@
+package webhook
+
+import (
+	"time"
+
+	"github.com/Financial-Times/list-notifications-rw/model"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockStore struct {
+	mock.Mock
+}
+
+func (m *MockStore) ReadSubscriptions() ([]model.Subscription, error) {
+	args := m.Called()
+	subscriptions := args.Get(0)
+	if subscriptions == nil {
+		return nil, args.Error(1)
+	}
+	return subscriptions.([]model.Subscription), args.Error(1)
+}
+
+func (m *MockStore) UpdateSubscriptionDelivery(id string, delivery model.SubscriptionDelivery) error {
+	args := m.Called(id, delivery)
+	return args.Error(0)
+}
+
+func (m *MockStore) WriteDeadLetter(deadLetter model.DeadLetter) error {
+	args := m.Called(deadLetter)
+	return args.Error(0)
+}
+
+func (m *MockStore) AcquireWebhookLease(owner string, ttl time.Duration) (bool, error) {
+	args := m.Called(owner, ttl)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStore) ReadNotifications(offset int, limit int, since time.Time, filter model.NotificationFilter) (*[]model.InternalNotification, error) {
+	args := m.Called(offset, limit, since, filter)
+	notifications := args.Get(0)
+	if notifications == nil {
+		return nil, args.Error(1)
+	}
+	return notifications.(*[]model.InternalNotification), args.Error(1)
+}
+
+func (m *MockStore) GetLimit() int {
+	args := m.Called()
+	return args.Int(0)
+}